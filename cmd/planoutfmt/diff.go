@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines shown around the changes of a diff
+const context = 3
+
+type edit struct {
+	op   byte // ' ' for a line of both scripts, '-' for a line removed, '+' for a line added
+	line string
+	a, b int // line numbers before the edit in the original and the formatted script
+}
+
+// diff returns the unified diff between the original and formatted scripts, or nil if they are equal
+func diff(filename string, original, formatted []byte) []byte {
+	edits := lineEdits(lines(original), lines(formatted))
+
+	var out bytes.Buffer
+	for start := 0; start < len(edits); {
+		// find the next change, then extend the hunk while changes are within the context
+		first := start
+		for first < len(edits) && edits[first].op == ' ' {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+		end := first
+		for i := first; i < len(edits) && i <= end+2*context; i++ {
+			if edits[i].op != ' ' {
+				end = i
+			}
+		}
+
+		from := max(first-context, start)
+		to := min(end+context+1, len(edits))
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "diff -u %s.orig %s\n--- %s.orig\n+++ %s\n", filename, filename, filename, filename)
+		}
+		writeHunk(&out, edits[from:to])
+		start = to
+	}
+	return out.Bytes()
+}
+
+func writeHunk(out *bytes.Buffer, edits []edit) {
+	var a, b int
+	for _, e := range edits {
+		if e.op != '+' {
+			a++
+		}
+		if e.op != '-' {
+			b++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(edits[0].a, a), hunkRange(edits[0].b, b))
+	for _, e := range edits {
+		out.WriteByte(e.op)
+		out.WriteString(e.line)
+		out.WriteByte('\n')
+	}
+}
+
+// hunkRange formats the range of a hunk starting after the given line
+func hunkRange(line, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", line)
+	}
+	return fmt.Sprintf("%d,%d", line+1, count)
+}
+
+func lines(text []byte) []string {
+	s := strings.TrimSuffix(string(text), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// lineEdits returns the edits turning a into b, from their longest common subsequence of lines
+func lineEdits(a, b []string) []edit {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', a[i], i, j})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j], i, j})
+			j++
+		}
+	}
+	return edits
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	original := "a=1;\nb = 2;\nc = 3;\nd = 4;\ne = 5;\nf = 6;\ng = 7;\nh = 8;\ni = 9;\nj=10;\n"
+	formatted := "a = 1;\nb = 2;\nc = 3;\nd = 4;\ne = 5;\nf = 6;\ng = 7;\nh = 8;\ni = 9;\nj = 10;\n"
+	expected := `diff -u x.planout.orig x.planout
+--- x.planout.orig
++++ x.planout
+@@ -1,4 +1,4 @@
+-a=1;
++a = 1;
+ b = 2;
+ c = 3;
+ d = 4;
+@@ -7,4 +7,4 @@
+ g = 7;
+ h = 8;
+ i = 9;
+-j=10;
++j = 10;
+`
+	if actual := string(diff("x.planout", []byte(original), []byte(formatted))); actual != expected {
+		t.Errorf("Expected\n%s\nActual\n%s", expected, actual)
+	}
+
+	if actual := diff("x.planout", []byte(formatted), []byte(formatted)); len(actual) != 0 {
+		t.Errorf("Expected no diff for equal scripts. Actual\n%s", actual)
+	}
+	if actual := string(diff("x.planout", nil, []byte("a = 1;\n"))); actual != "diff -u x.planout.orig x.planout\n--- x.planout.orig\n+++ x.planout\n@@ -0,0 +1,1 @@\n+a = 1;\n" {
+		t.Errorf("Expected a diff adding a line. Actual\n%s", actual)
+	}
+}
@@ -0,0 +1,142 @@
+// Planoutfmt formats PlanOut scripts.
+//
+// Without paths, it formats the standard input. Directories are walked for .planout files.
+// By default, the formatted scripts are written to the standard output.
+//
+// Usage:
+//
+//	planoutfmt [flags] [path ...]
+//
+// The flags are:
+//
+//	-d
+//		Do not print the formatted scripts, print the diffs with the scripts instead.
+//	-w
+//		Do not print the formatted scripts, write them back to their files instead.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/biased-unit/planout-golang/compiler"
+	"github.com/biased-unit/planout-golang/compiler/format"
+)
+
+var (
+	write  = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	doDiff = flag.Bool("d", false, "display diffs instead of rewriting files")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: planoutfmt [flags] [path ...]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	failed := false
+	report := func(err error) {
+		fmt.Fprintln(os.Stderr, err)
+		failed = true
+	}
+
+	if flag.NArg() == 0 {
+		if *write {
+			report(fmt.Errorf("cannot use -w with standard input"))
+		} else if err := processFile("<standard input>", os.Stdin, os.Stdout); err != nil {
+			report(err)
+		}
+	}
+
+	for _, path := range flag.Args() {
+		err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			// the files named on the command line are formatted whatever their extension
+			if info.IsDir() || filepath.Ext(path) != ".planout" && !isArg(path) {
+				return nil
+			}
+			if err := processFile(path, nil, os.Stdout); err != nil {
+				report(err)
+			}
+			return nil
+		})
+		if err != nil {
+			report(err)
+		}
+	}
+
+	if failed {
+		os.Exit(2)
+	}
+}
+
+func isArg(path string) bool {
+	for _, arg := range flag.Args() {
+		if path == arg {
+			return true
+		}
+	}
+	return false
+}
+
+// processFile formats the script read from in, or from the file if in is nil
+func processFile(filename string, in io.Reader, out io.Writer) error {
+	if in == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	res, err := format.Source(src)
+	if errs, ok := err.(compiler.ParserErrors); ok {
+		var msg bytes.Buffer
+		for i, err := range errs {
+			if i > 0 {
+				msg.WriteString("\n")
+			}
+			fmt.Fprintf(&msg, "%s:%v", filename, err)
+		}
+		return fmt.Errorf("%s", msg.String())
+	} else if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+
+	if !bytes.Equal(src, res) {
+		if *write {
+			info, err := os.Stat(filename)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(filename, res, info.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+		if *doDiff {
+			_, err := out.Write(diff(filename, src, res))
+			return err
+		}
+	}
+
+	if !*write && !*doDiff {
+		_, err = out.Write(res)
+	}
+	return err
+}
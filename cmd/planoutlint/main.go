@@ -0,0 +1,120 @@
+// Planoutlint reports likely mistakes in PlanOut scripts, such as a random operator without
+// a unit, or two parameters hashed with the same salt.
+//
+// Without paths, it checks the standard input. Directories are walked for .planout files.
+// It exits with status 1 if there are warnings, and 2 if a script cannot be read or parsed.
+//
+// Usage:
+//
+//	planoutlint [path ...]
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/biased-unit/planout-golang/compiler"
+	"github.com/biased-unit/planout-golang/compiler/lint"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run checks the scripts named by the arguments, or the standard input, and returns the exit status
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("planoutlint", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: planoutlint [path ...]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	failed, warned := false, false
+	report := func(err error) {
+		fmt.Fprintln(stderr, err)
+		failed = true
+	}
+	check := func(filename string, in io.Reader) {
+		n, err := processFile(filename, in, stdout)
+		if err != nil {
+			report(err)
+		}
+		warned = warned || n > 0
+	}
+
+	if flags.NArg() == 0 {
+		check("<standard input>", stdin)
+	}
+
+	for _, arg := range flags.Args() {
+		err := filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			// the files named on the command line are checked whatever their extension
+			if info.IsDir() || filepath.Ext(path) != ".planout" && path != arg {
+				return nil
+			}
+			check(path, nil)
+			return nil
+		})
+		if err != nil {
+			report(err)
+		}
+	}
+
+	if failed {
+		return 2
+	}
+	if warned {
+		return 1
+	}
+	return 0
+}
+
+// processFile checks the script read from in, or from the file if in is nil, and returns the number of warnings
+func processFile(filename string, in io.Reader, out io.Writer) (int, error) {
+	if in == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return 0, err
+	}
+
+	warnings, err := lint.Source(src)
+	if errs, ok := err.(compiler.ParserErrors); ok {
+		var msg bytes.Buffer
+		for i, err := range errs {
+			if i > 0 {
+				msg.WriteString("\n")
+			}
+			fmt.Fprintf(&msg, "%s:%v", filename, err)
+		}
+		return 0, fmt.Errorf("%s", msg.String())
+	} else if err != nil {
+		return 0, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	for _, w := range warnings {
+		if _, err := fmt.Fprintf(out, "%s:%s\n", filename, w); err != nil {
+			return 0, err
+		}
+	}
+	return len(warnings), nil
+}
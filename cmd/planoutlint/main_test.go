@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "planoutlint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clean := filepath.Join(dir, "clean.planout")
+	warned := filepath.Join(dir, "warned.planout")
+	broken := filepath.Join(dir, "broken.planout")
+	files := map[string]string{
+		clean:  "x = uniformChoice(choices=[1, 2], unit=userid);\n",
+		warned: "x = uniformChoice(choices=[1, 2]);\ny = weightedChoice(choices=[1, 2], weights=[1], unit=userid);\n",
+		broken: "x = ;\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(name, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		status int
+		stdout string
+		stderr string
+	}{
+		{"clean file", []string{clean}, "", 0, "", ""},
+		{
+			"file with warnings",
+			[]string{warned},
+			"",
+			1,
+			warned + ":1:5: uniformChoice without a unit (missing-unit)\n" +
+				warned + ":2:5: weightedChoice has 2 choices but 1 weights (weights-mismatch)\n",
+			"",
+		},
+		{"standard input", nil, "x = bernoulliTrial(p=0.5);\n", 1, "<standard input>:1:5: bernoulliTrial without a unit (missing-unit)\n", ""},
+		{"unreadable path", []string{filepath.Join(dir, "missing.planout")}, "", 2, "", "no such file or directory"},
+		{"syntax error", []string{broken}, "", 2, "", broken + ":1:5: no prefix parse function for token type ;\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(tc.args, strings.NewReader(tc.stdin), &stdout, &stderr)
+			if status != tc.status {
+				t.Errorf("Expected exit status %d. Actual %d (%s)", tc.status, status, stderr.String())
+			}
+			if stdout.String() != tc.stdout {
+				t.Errorf("Expected output\n%s\nActual\n%s", tc.stdout, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), tc.stderr) || tc.stderr == "" && stderr.Len() > 0 {
+				t.Errorf("Expected errors containing %q. Actual %q", tc.stderr, stderr.String())
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package planout
 
 import (
+	"bytes"
 	"encoding/json"
 
 	"github.com/biased-unit/planout-golang/compiler"
@@ -18,10 +19,61 @@ func Compile(script string) (map[string]interface{}, error) {
 		return nil, err
 	}
 
+	return Decode(marshalled)
+}
+
+// CompileWithSourceMap is like Compile, and also returns the source map of the code, for an Interpreter
+// to report where its errors are in the script
+func CompileWithSourceMap(script string) (map[string]interface{}, compiler.SourceMap, error) {
+	lx := lexer.New(script)
+	ps := parser.New(lx)
+	comp := compiler.New(ps).WithSourceMap()
+
+	marshalled, err := comp.Run()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	code, err := Decode(marshalled)
+	if err != nil {
+		return nil, nil, err
+	}
+	return code, comp.SourceMap(), nil
+}
+
+// Decode parses compiled PlanOut JSON into code that can be run by an Interpreter.
+// Unlike json.Unmarshal, integer literals are decoded as int64 instead of float64,
+// so integer arithmetic in the script yields integers as in the reference PlanOut.
+func Decode(data []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
 	var result map[string]interface{}
-	if err := json.Unmarshal(marshalled, &result); err != nil {
+	if err := dec.Decode(&result); err != nil {
 		return nil, err
 	}
 
+	decodeNumbers(result)
 	return result, nil
 }
+
+// decodeNumbers replaces every json.Number inside value with an int64 or a float64
+func decodeNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case []interface{}:
+		for i := range value {
+			value[i] = decodeNumbers(value[i])
+		}
+	case map[string]interface{}:
+		for k, v := range value {
+			value[k] = decodeNumbers(v)
+		}
+	}
+	return value
+}
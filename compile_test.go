@@ -0,0 +1,69 @@
+package planout
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/biased-unit/planout-golang/compiler"
+	"github.com/biased-unit/planout-golang/compiler/lexer"
+	"github.com/biased-unit/planout-golang/compiler/parser"
+)
+
+// TestCompile_Optimized checks that optimized scripts assign the same parameters as the original scripts
+func TestCompile_Optimized(t *testing.T) {
+	scripts := []string{
+		`share = 1 / 100;
+		 enabled = bernoulliTrial(p=share * 10, unit=userid);
+		 color = uniformChoice(choices=["red", "blue"], unit=userid);`,
+		`if (1 > 2) {
+		   size = 1;
+		 } else if (userid % 2 == 0) {
+		   size = weightedChoice(choices=[10, 20], weights=[1 / 4, 3 / 4], unit=userid);
+		 } else {
+		   size = 3 * 4 + 0.5;
+		 }
+		 label = "size" + 1;`,
+		`if (true) {
+		   x = randomInteger(min=0, max=10 - 1, unit=userid);
+		   return x > 4;
+		 }
+		 y = 1;`,
+		`if (false) {
+		   x = 1;
+		 }`,
+	}
+
+	for _, script := range scripts {
+		original, err := compiler.New(parser.New(lexer.New(script))).Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		optimized, err := compiler.New(parser.New(lexer.New(script))).WithOptimization().Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for userid := 0; userid < 100; userid++ {
+			expected, expectedOk := runCompiled(t, original, userid)
+			actual, actualOk := runCompiled(t, optimized, userid)
+			if expectedOk != actualOk || !reflect.DeepEqual(expected, actual) {
+				t.Fatalf("Outputs of %s for userid %d. Expected %v. Actual %v\n", script, userid, expected, actual)
+			}
+		}
+	}
+}
+
+func runCompiled(t *testing.T, data []byte, userid int) (map[string]interface{}, bool) {
+	code, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expt := &Interpreter{
+		Salt:      "foo",
+		Inputs:    map[string]interface{}{"userid": userid},
+		Outputs:   map[string]interface{}{},
+		Overrides: map[string]interface{}{},
+		Code:      code,
+	}
+	return expt.Run()
+}
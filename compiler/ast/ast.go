@@ -1,6 +1,9 @@
 package ast
 
 import (
+	"bytes"
+	"encoding/json"
+
 	"github.com/biased-unit/planout-golang/compiler/token"
 )
 
@@ -15,6 +18,28 @@ type Expression interface {
 	expressionNode()
 }
 
+// Node is implemented by the statements and expressions that record the part of the
+// script they were parsed from. Literal numbers, strings and booleans are plain values
+// without a position: the span of the node containing them covers them.
+type Node interface {
+	SourceSpan() Span
+	SetSpan(start, end token.Position)
+}
+
+// Span is the part of the script a node was parsed from. It is left out of the compiled JSON.
+type Span struct {
+	Start token.Position // position of the first character
+	End   token.Position // position just past the last character
+}
+
+func (s Span) SourceSpan() Span {
+	return s
+}
+
+func (s *Span) SetSpan(start, end token.Position) {
+	s.Start, s.End = start, end
+}
+
 func NewProgram() *Program {
 	return &Program{
 		Op:  "seq",
@@ -23,8 +48,9 @@ func NewProgram() *Program {
 }
 
 type Program struct {
-	Op  string      `json:"op"`
-	Seq []Statement `json:"seq"`
+	Span `json:"-"`
+	Op   string      `json:"op"`
+	Seq  []Statement `json:"seq"`
 }
 
 func NewSwitchStatement(cases ...Case) *SwitchStatement {
@@ -35,6 +61,7 @@ func NewSwitchStatement(cases ...Case) *SwitchStatement {
 
 	for _, cs := range cases {
 		result.Cases = append(result.Cases, Case{
+			Span:      cs.Span,
 			Op:        "case",
 			Condition: cs.Condition,
 			Result:    cs.Result,
@@ -45,6 +72,7 @@ func NewSwitchStatement(cases ...Case) *SwitchStatement {
 }
 
 type SwitchStatement struct {
+	Span  `json:"-"`
 	Op    string `json:"op"`
 	Cases []Case `json:"cases"`
 }
@@ -52,6 +80,7 @@ type SwitchStatement struct {
 func (se *SwitchStatement) statementNode() {}
 
 type Case struct {
+	Span      `json:"-"`
 	Op        string     `json:"op"`
 	Condition Expression `json:"condidion"` // This typo is present in the language definition
 	Result    Statement  `json:"result"`
@@ -66,6 +95,7 @@ func NewAssignmentStatement(varName string, value Expression) *AssignmentStateme
 }
 
 type AssignmentStatement struct {
+	Span  `json:"-"`
 	Op    string     `json:"op"`
 	Var   string     `json:"var"`
 	Value Expression `json:"value"`
@@ -81,6 +111,7 @@ func NewReturnStatement(value Expression) *ReturnStatement {
 }
 
 type ReturnStatement struct {
+	Span  `json:"-"`
 	Op    string     `json:"op"`
 	Value Expression `json:"value"`
 }
@@ -98,6 +129,7 @@ func NewIfStatement(cond ...Conditional) *IfStatement {
 }
 
 type IfStatement struct {
+	Span `json:"-"`
 	Op   string        `json:"op"`
 	Cond []Conditional `json:"cond"`
 }
@@ -105,6 +137,7 @@ type IfStatement struct {
 func (ie *IfStatement) statementNode() {}
 
 type Conditional struct {
+	Span        `json:"-"`
 	Condition   Expression      `json:"if"`
 	Consequence *BlockStatement `json:"then"`
 }
@@ -120,8 +153,9 @@ func NewBlockStatement(seq ...Statement) *BlockStatement {
 }
 
 type BlockStatement struct {
-	Op  string      `json:"op"`
-	Seq []Statement `json:"seq"`
+	Span `json:"-"`
+	Op   string      `json:"op"`
+	Seq  []Statement `json:"seq"`
 }
 
 func NewPrefixExpression(tok token.Type, right Expression) Expression {
@@ -142,6 +176,7 @@ func NewPrefixExpression(tok token.Type, right Expression) Expression {
 }
 
 type PrefixExpression struct {
+	Span  `json:"-"`
 	Op    string     `json:"op"`
 	Value Expression `json:"value"`
 }
@@ -235,6 +270,7 @@ func NewInfixExpression(tok token.Type, left, right Expression) Expression {
 }
 
 type InfixExpressionLeftRight struct {
+	Span  `json:"-"`
 	Op    string     `json:"op"`
 	Left  Expression `json:"left"`
 	Right Expression `json:"right"`
@@ -243,6 +279,7 @@ type InfixExpressionLeftRight struct {
 func (s *InfixExpressionLeftRight) expressionNode() {}
 
 type InfixExpressionValues struct {
+	Span   `json:"-"`
 	Op     string        `json:"op"`
 	Values [2]Expression `json:"values"`
 }
@@ -257,8 +294,9 @@ func NewIdentifierExpression(varName string) *Identifier {
 }
 
 type Identifier struct {
-	Op  string `json:"op"`
-	Var string `json:"var"`
+	Span `json:"-"`
+	Op   string `json:"op"`
+	Var  string `json:"var"`
 }
 
 func (s *Identifier) expressionNode() {}
@@ -290,6 +328,7 @@ func NewArrayLiteral(vals []Expression) *ArrayLiteral {
 }
 
 type ArrayLiteral struct {
+	Span   `json:"-"`
 	Op     string       `json:"op"`
 	Values []Expression `json:"values"`
 }
@@ -300,7 +339,9 @@ func NewNull() *NullLiteral {
 	return &NullLiteral{}
 }
 
-type NullLiteral struct{}
+type NullLiteral struct {
+	Span
+}
 
 func (nl *NullLiteral) expressionNode() {}
 func (nl *NullLiteral) MarshalJSON() ([]byte, error) {
@@ -316,6 +357,7 @@ func NewJSONLiteral(val interface{}) *JSONLiteral {
 
 // JSONLiteral can be a JSON array, map, string, or number
 type JSONLiteral struct {
+	Span  `json:"-"`
 	Op    string      `json:"op"`
 	Value interface{} `json:"value"`
 }
@@ -331,6 +373,7 @@ func NewIndexExpression(base, index Expression) *IndexExpression {
 }
 
 type IndexExpression struct {
+	Span  `json:"-"`
 	Op    string     `json:"op"`
 	Base  Expression `json:"base"`
 	Index Expression `json:"index"`
@@ -349,22 +392,23 @@ func NewFunctionCall(fName string, args ...Expression) Expression {
 	}
 }
 
-func NewFunctionCallNamedArgs(fName string, args map[string]Expression) Expression {
+// NewFunctionCallNamedArgs creates a call with named arguments. names is the order of the arguments in the source.
+func NewFunctionCallNamedArgs(fName string, args map[string]Expression, names ...string) Expression {
 	if args == nil {
 		args = make(map[string]Expression)
 	}
-	x := NamedArgs(args)
-	x["op"] = StringLiteral(fName)
-	return &x
+	return &FunctionCallNamedArgs{Op: fName, Args: args, Names: names}
 }
 
 type FunctionCallNoArgs struct {
-	Op string `json:"op"`
+	Span `json:"-"`
+	Op   string `json:"op"`
 }
 
 func (fca *FunctionCallNoArgs) expressionNode() {}
 
 type FunctionCallOneArg struct {
+	Span  `json:"-"`
 	Value Expression `json:"value"`
 	Op    string     `json:"op"`
 }
@@ -372,6 +416,7 @@ type FunctionCallOneArg struct {
 func (fco *FunctionCallOneArg) expressionNode() {}
 
 type FunctionCallManyArgs struct {
+	Span   `json:"-"`
 	Values []Expression `json:"values"`
 	Op     string       `json:"op"`
 }
@@ -381,3 +426,48 @@ func (fcm *FunctionCallManyArgs) expressionNode() {}
 type NamedArgs map[string]Expression
 
 func (fcn *NamedArgs) expressionNode() {}
+
+// FunctionCallNamedArgs compiles to an object holding the op and each argument by name
+type FunctionCallNamedArgs struct {
+	Span
+	Op    string
+	Args  NamedArgs
+	Names []string // names of the arguments in the order of the source
+	// SourceOrder writes the arguments in the order of the source, then the op, like the official compiler.
+	// Otherwise the keys are sorted.
+	SourceOrder bool
+}
+
+func (fcn *FunctionCallNamedArgs) expressionNode() {}
+
+func (fcn *FunctionCallNamedArgs) MarshalJSON() ([]byte, error) {
+	if !fcn.SourceOrder {
+		x := make(map[string]interface{}, len(fcn.Args)+1)
+		for name, arg := range fcn.Args {
+			x[name] = arg
+		}
+		x["op"] = fcn.Op
+		return json.Marshal(x)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	buf.WriteString("{")
+	for _, name := range fcn.ArgNames() {
+		if err := enc.Encode(name); err != nil {
+			return nil, err
+		}
+		buf.WriteString(":")
+		if err := enc.Encode(fcn.Args[name]); err != nil {
+			return nil, err
+		}
+		buf.WriteString(",")
+	}
+	buf.WriteString(`"op":`)
+	if err := enc.Encode(fcn.Op); err != nil {
+		return nil, err
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
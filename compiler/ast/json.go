@@ -0,0 +1,82 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// JSONObject is a JSON object that keeps the order of its keys
+type JSONObject struct {
+	Keys   []string
+	Values map[string]interface{}
+}
+
+// Get returns the value of a key, or nil if the object does not have it
+func (o *JSONObject) Get(key string) interface{} {
+	return o.Values[key]
+}
+
+// MarshalJSON writes the values in the order of the keys
+func (o *JSONObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	buf.WriteString("{")
+	for i, key := range o.Keys {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		if err := enc.Encode(key); err != nil {
+			return nil, err
+		}
+		buf.WriteString(":")
+		if err := enc.Encode(o.Values[key]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// DecodeJSON reads the next JSON value of dec, with its objects as *JSONObject in the order of the source.
+// A repeated key keeps its first place and its last value. Numbers are json.Number if dec uses them.
+func DecodeJSON(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		obj := &JSONObject{Values: make(map[string]interface{})}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := DecodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			k := key.(string)
+			if _, seen := obj.Values[k]; !seen {
+				obj.Keys = append(obj.Keys, k)
+			}
+			obj.Values[k] = value
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		list := make([]interface{}, 0)
+		for dec.More() {
+			value, err := DecodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := dec.Token()
+		return list, err
+	}
+	return tok, nil
+}
@@ -0,0 +1,33 @@
+package ast
+
+// randomOps maps the operators that draw their result from a hash of their arguments to whether
+// they hash a unit with the salts of the experiment
+var randomOps = map[string]bool{
+	"uniformChoice":     true,
+	"bernoulliTrial":    true,
+	"bernoulliFilter":   true,
+	"weightedChoice":    true,
+	"randomInteger":     true,
+	"randomFloat":       true,
+	"sample":            true,
+	"shuffle":           true,
+	"randomNormal":      true,
+	"randomExponential": true,
+	"saltedChoice":      true,
+	"rollout":           true,
+	"hash":              false,
+	"bucket":            false,
+}
+
+// IsRandomOp reports whether an operator draws its result from a hash of its arguments,
+// so that changing any of its arguments changes the assignments
+func IsRandomOp(op string) bool {
+	_, ok := randomOps[op]
+	return ok
+}
+
+// HashesUnit reports whether an operator hashes a unit with the salts of the experiment,
+// as all the random operators but hash and bucket do
+func HashesUnit(op string) bool {
+	return randomOps[op]
+}
@@ -0,0 +1,92 @@
+package ast
+
+import "sort"
+
+// Inspect traverses a tree in depth-first order, in the order of the source: it calls f for
+// the node, then inspects each of its children if f returns true. Nodes are statements,
+// expressions, and the Conditional and Case of if and switch statements.
+func Inspect(node interface{}, f func(node interface{}) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, stmt := range n.Seq {
+			Inspect(stmt, f)
+		}
+	case *BlockStatement:
+		for _, stmt := range n.Seq {
+			Inspect(stmt, f)
+		}
+	case *AssignmentStatement:
+		Inspect(n.Value, f)
+	case *ReturnStatement:
+		Inspect(n.Value, f)
+	case *IfStatement:
+		for i := range n.Cond {
+			Inspect(&n.Cond[i], f)
+		}
+	case *Conditional:
+		Inspect(n.Condition, f)
+		if n.Consequence != nil {
+			Inspect(n.Consequence, f)
+		}
+	case *SwitchStatement:
+		for i := range n.Cases {
+			Inspect(&n.Cases[i], f)
+		}
+	case *Case:
+		Inspect(n.Condition, f)
+		Inspect(n.Result, f)
+	case *PrefixExpression:
+		Inspect(n.Value, f)
+	case *InfixExpressionLeftRight:
+		Inspect(n.Left, f)
+		Inspect(n.Right, f)
+	case *InfixExpressionValues:
+		Inspect(n.Values[0], f)
+		Inspect(n.Values[1], f)
+	case *ArrayLiteral:
+		for _, v := range n.Values {
+			Inspect(v, f)
+		}
+	case *IndexExpression:
+		Inspect(n.Base, f)
+		Inspect(n.Index, f)
+	case *FunctionCallOneArg:
+		Inspect(n.Value, f)
+	case *FunctionCallManyArgs:
+		for _, v := range n.Values {
+			Inspect(v, f)
+		}
+	case *FunctionCallNamedArgs:
+		for _, name := range n.ArgNames() {
+			Inspect(n.Args[name], f)
+		}
+	}
+}
+
+// ArgNames returns the names of the arguments in the order of the source,
+// or sorted if the order is not known
+func (fcn *FunctionCallNamedArgs) ArgNames() []string {
+	if len(fcn.Names) == len(fcn.Args) {
+		return fcn.Names
+	}
+	names := make([]string, 0, len(fcn.Args))
+	for name := range fcn.Args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// KeepSourceOrder sets SourceOrder on the calls with named arguments of a tree
+func KeepSourceOrder(node interface{}) {
+	Inspect(node, func(node interface{}) bool {
+		if call, ok := node.(*FunctionCallNamedArgs); ok {
+			call.SourceOrder = true
+		}
+		return true
+	})
+}
@@ -3,11 +3,20 @@ package compiler
 import (
 	"bytes"
 	"encoding/json"
+	"github.com/biased-unit/planout-golang/compiler/ast"
+	"github.com/biased-unit/planout-golang/compiler/optimize"
 	"github.com/biased-unit/planout-golang/compiler/parser"
+	"github.com/biased-unit/planout-golang/compiler/types"
 )
 
 type Compiler struct {
-	p *parser.Parser
+	p         *parser.Parser
+	inputs    types.Schema
+	outputs   types.Schema
+	optimize  bool
+	strict    bool
+	mapSource bool
+	sourceMap SourceMap
 }
 
 func New(p *parser.Parser) *Compiler {
@@ -16,6 +25,46 @@ func New(p *parser.Parser) *Compiler {
 	}
 }
 
+// WithInputs makes Run check the types of the script, given the types of its inputs.
+// Reading a variable that is neither assigned nor declared in inputs is an error.
+// The type errors are returned by Run as ParserErrors.
+func (c *Compiler) WithInputs(inputs types.Schema) *Compiler {
+	c.inputs = inputs
+	return c
+}
+
+// Outputs returns the types of the parameters of the script inferred by Run, if it was given inputs
+func (c *Compiler) Outputs() types.Schema {
+	return c.outputs
+}
+
+// WithOptimization makes Run fold the constant expressions of the script and remove the branches that
+// can never be taken, without changing the values the script assigns
+func (c *Compiler) WithOptimization() *Compiler {
+	c.optimize = true
+	return c
+}
+
+// WithStrict makes Run only compile the scripts that the official compiler accepts, to exactly the same JSON.
+// The syntax the official compiler does not accept, such as comments, is reported as ParserErrors.
+func (c *Compiler) WithStrict() *Compiler {
+	c.strict = true
+	c.p.SetStrict(true)
+	return c
+}
+
+// WithSourceMap makes Run record where each node of the compiled program comes from in the script,
+// for an Interpreter to report the location of its errors
+func (c *Compiler) WithSourceMap() *Compiler {
+	c.mapSource = true
+	return c
+}
+
+// SourceMap returns the source map of the program compiled by Run, if it was asked for with WithSourceMap
+func (c *Compiler) SourceMap() SourceMap {
+	return c.sourceMap
+}
+
 type ParserErrors []error
 
 func (pe ParserErrors) Error() string {
@@ -34,10 +83,30 @@ func (c *Compiler) Run() ([]byte, error) {
 		return nil, ParserErrors(c.p.Errors())
 	}
 
+	if c.inputs != nil {
+		outputs, errs := types.Check(program, c.inputs)
+		if len(errs) > 0 {
+			return nil, ParserErrors(errs)
+		}
+		c.outputs = outputs
+	}
+
+	if c.optimize {
+		optimize.Program(program)
+	}
+
+	if c.mapSource {
+		c.sourceMap = buildSourceMap(program)
+	}
+
 	if len(program.Seq) == 0 {
 		return []byte(`{}`), nil
 	}
 
+	if c.strict {
+		ast.KeepSourceOrder(program)
+	}
+
 	buffer := new(bytes.Buffer)
 	enc := json.NewEncoder(buffer)
 	enc.SetEscapeHTML(false) // so angle brackets are properly encoded (https://www.alexedwards.net/blog/json-surprises-and-gotchas#5)
@@ -47,5 +116,40 @@ func (c *Compiler) Run() ([]byte, error) {
 		return nil, err
 	}
 
+	if c.strict {
+		// JSON.stringify does not end its output with a new line
+		return bytes.TrimSuffix(jsEscapes(buffer.Bytes()), []byte("\n")), nil
+	}
+
 	return buffer.Bytes(), nil
 }
+
+var jsReplacements = map[string]string{
+	`\u2028`: "\u2028",
+	`\u2029`: "\u2029",
+	`\u0008`: `\b`,
+	`\u000c`: `\f`,
+}
+
+// jsEscapes replaces the escape sequences of encoding/json that differ from those of JSON.stringify,
+// which writes the line and paragraph separators as they are, and uses \b and \f
+func jsEscapes(code []byte) []byte {
+	out := make([]byte, 0, len(code))
+	for i := 0; i < len(code); i++ {
+		if code[i] != '\\' {
+			out = append(out, code[i])
+			continue
+		}
+		// escape sequences only appear in strings, and never overlap
+		if i+6 <= len(code) {
+			if r, ok := jsReplacements[string(code[i:i+6])]; ok {
+				out = append(out, r...)
+				i += 5
+				continue
+			}
+		}
+		out = append(out, code[i], code[i+1])
+		i++
+	}
+	return out
+}
@@ -1,11 +1,17 @@
 package compiler
 
 import (
+	"bytes"
+	"encoding/json"
 	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/biased-unit/planout-golang/compiler/lexer"
 	"github.com/biased-unit/planout-golang/compiler/parser"
+	"github.com/biased-unit/planout-golang/compiler/types"
 	"github.com/stretchr/testify/require"
 )
 
@@ -300,6 +306,11 @@ func TestCompiler_Run(t *testing.T) {
 			`return hello(str="world");`,
 			`{"op":"seq","seq":[{"op":"return","value":{"str":"world","op":"hello"}}]}`,
 		},
+		{
+			"string escape sequences",
+			`a = "say \"hi\"\n"; b = 'it\'s \u00e9\\';`,
+			`{"op":"seq","seq":[{"op":"set","var":"a","value":"say \"hi\"\n"},{"op":"set","var":"b","value":"it's é\\"}]}`,
+		},
 		{
 			"function call named args",
 			`result = myFunc(a=c, x="y");`,
@@ -358,3 +369,257 @@ func TestCompiler_RunFixtures(t *testing.T) {
 
 	}
 }
+
+func TestCompiler_RunErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			"independent statements",
+			"x = ;\ny = 2;\nz = (3;\nw = 4;",
+			[]string{
+				"1:5: no prefix parse function for token type ;",
+				`3:7: expecting ")", got ";"`,
+			},
+		},
+		{
+			"errors inside a block",
+			"if (a) {\n  b = ;\n  c = 1;\n  d = [1 2];\n}\ne = ;",
+			[]string{
+				"2:7: no prefix parse function for token type ;",
+				`4:10: expecting "]", got "2"`,
+				"6:5: no prefix parse function for token type ;",
+			},
+		},
+		{
+			"errors following an error are skipped with its statement",
+			"if (a ==) {\n  b = ;\n} else {\n  c = ;\n}\nd = 1;",
+			[]string{
+				"1:9: no prefix parse function for token type )",
+			},
+		},
+		{
+			"lexing and parsing errors",
+			"a = 2 ? 3;\nb = @{bad;\nc = 1 $ 2;\nd = ;",
+			[]string{
+				`1:7: invalid token: "?" (use "??" for COALESCE)`,
+				"2:5: failed to parse JSON literal: invalid character 'b' looking for beginning of object key string",
+				"3:7: unexpected character: '$'",
+				"4:5: no prefix parse function for token type ;",
+			},
+		},
+		{
+			"errors inside a switch",
+			"switch {\n a => x = ;\n b => y = ;\n c => z = 1;\n d => e = (1;\n}\nz = ;",
+			[]string{
+				"2:11: no prefix parse function for token type ;",
+				"3:11: no prefix parse function for token type ;",
+				`5:13: expecting ")", got ";"`,
+				"7:5: no prefix parse function for token type ;",
+			},
+		},
+		{
+			"non-ASCII letter outside a string",
+			"x = é;\ny = ;",
+			[]string{
+				"1:5: unexpected character: 'é'",
+				"2:5: no prefix parse function for token type ;",
+			},
+		},
+		{
+			"stray closing brace",
+			"x = 1;\n}\ny = ;",
+			[]string{
+				`2:1: expecting ["IDENTIFIER" "if" "return" "switch"], got "}"`,
+				"3:5: no prefix parse function for token type ;",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(parser.New(lexer.New(tc.input))).Run()
+			require.IsType(t, ParserErrors{}, err)
+
+			var actual []string
+			for _, e := range err.(ParserErrors) {
+				actual = append(actual, e.Error())
+			}
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestCompiler_RunWithInputs(t *testing.T) {
+	inputs := types.Schema{"userid": types.Of(types.String), "age": types.Of(types.Integer)}
+
+	c := New(parser.New(lexer.New("group = uniformChoice(choices=['a', 'b'], unit=userid);\nadult = age >= 18;")))
+	_, err := c.WithInputs(inputs).Run()
+	require.NoError(t, err)
+	require.Equal(t, types.Schema{"group": types.Of(types.String), "adult": types.Of(types.Boolean)}, c.Outputs())
+
+	script := "adult = age >= '18';\nx = usrid;"
+	_, err = New(parser.New(lexer.New(script))).WithInputs(inputs).Run()
+	require.Equal(t, "1:9: cannot compare integer and string\n"+
+		"adult = age >= '18';\n"+
+		"        ^^^^^^^^^^^\n"+
+		"2:5: undeclared input: usrid\n"+
+		"x = usrid;\n"+
+		"    ^^^^^\n", FormatDiagnostics(script, err))
+
+	// without inputs, the types are not checked
+	_, err = New(parser.New(lexer.New(script))).Run()
+	require.NoError(t, err)
+}
+
+func TestCompiler_RunSourceMap(t *testing.T) {
+	script := "a = 1 + 2;\nif (a > 2) {\n  b = uniformChoice(choices=[1, x], unit=userid);\n} else {\n  b = a[0];\n}"
+	c := New(parser.New(lexer.New(script))).WithSourceMap().WithOptimization()
+	compiled, err := c.Run()
+	require.NoError(t, err)
+
+	var code interface{}
+	require.NoError(t, json.Unmarshal(compiled, &code))
+
+	sm := c.SourceMap()
+	require.Equal(t, "1:1", sm[""].String())
+	require.Equal(t, "1:1", sm["/seq/0"].String())
+	require.Equal(t, "3:3", sm["/seq/1/cond/0/then/seq/0"].String())
+	require.Equal(t, "3:33", sm["/seq/1/cond/0/then/seq/0/value/choices/values/1"].String())
+	require.Equal(t, "5:7", sm["/seq/1/cond/1/then/seq/0/value/base"].String())
+	// the folded sum is a literal without a location
+	require.NotContains(t, sm, "/seq/0/value")
+
+	// each pointer is that of an object of the compiled JSON
+	for pointer := range sm {
+		node := code
+		if pointer != "" {
+			for _, key := range strings.Split(pointer[1:], "/") {
+				switch n := node.(type) {
+				case map[string]interface{}:
+					node = n[key]
+				case []interface{}:
+					i, err := strconv.Atoi(key)
+					require.NoError(t, err)
+					node = n[i]
+				}
+			}
+		}
+		require.IsType(t, map[string]interface{}{}, node, pointer)
+	}
+
+	// without WithSourceMap, there is no source map
+	c = New(parser.New(lexer.New(script)))
+	_, err = c.Run()
+	require.NoError(t, err)
+	require.Nil(t, c.SourceMap())
+}
+
+// TestCompiler_RunStrict states the output expected from the rules of JSON.parse and JSON.stringify. The same
+// scripts are in testdata/strict, to be compared with the output of the official compiler.
+func TestCompiler_RunStrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"JSON literals in the order of JSON.parse",
+			`x = @{"b": 1, "a": 2, "10": 3, "2": 4, "01": 5, "b": 6, "4294967295": 7, "-1": 8, "x": {"z": 1, "0": [1.0, 1e21, 1e-7, 0.000001]}};`,
+			`{"op":"seq","seq":[{"op":"set","var":"x","value":{"op":"literal","value":{"2":4,"10":3,"b":6,"a":2,"01":5,"4294967295":7,"-1":8,"x":{"0":[1,1e+21,1e-7,0.000001],"z":1}}}}]}`,
+		},
+		{
+			"strings escaped like JSON.stringify",
+			"x = \"a b\"; y = @\"\\b\\f\\u2029\";",
+			"{\"op\":\"seq\",\"seq\":[{\"op\":\"set\",\"var\":\"x\",\"value\":\"a b\"},{\"op\":\"set\",\"var\":\"y\",\"value\":{\"op\":\"literal\",\"value\":\"\\b\\f \"}}]}",
+		},
+		{
+			"operators with spaces",
+			"x = 1 + 1 - a;",
+			`{"op":"seq","seq":[{"op":"set","var":"x","value":{"op":"sum","values":[{"op":"sum","values":[1,1]},{"op":"negative","value":{"op":"get","var":"a"}}]}}]}`,
+		},
+		{
+			"operators followed by an identifier or a negative number",
+			"x = a-b; y = a - -1;",
+			`{"op":"seq","seq":[{"op":"set","var":"x","value":{"op":"sum","values":[{"op":"get","var":"a"},{"op":"negative","value":{"op":"get","var":"b"}}]}},{"op":"set","var":"y","value":{"op":"sum","values":[{"op":"get","var":"a"},{"op":"negative","value":-1}]}}]}`,
+		},
+		{
+			"switch cases with an if statement",
+			`switch { a => if (true) { x = 1; }; }`,
+			`{"op":"seq","seq":[{"op":"switch","cases":[{"op":"case","condidion":{"op":"get","var":"a"},"result":{"op":"cond","cond":[{"if":true,"then":{"op":"seq","seq":[{"op":"set","var":"x","value":1}]}}]}}]}]}`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := New(parser.New(lexer.New(tc.input))).WithStrict().Run()
+			require.NoError(t, err)
+
+			var compact bytes.Buffer
+			require.NoError(t, json.Compact(&compact, actual))
+			require.Equal(t, tc.expected, compact.String())
+		})
+	}
+}
+
+// TestCompiler_RunStrictFixtures compares the output with that of the official compiler byte for byte.
+// The fixtures of testdata/strict are generated with testdata/strict/generate.js, which records the
+// version of the official compiler it used in testdata/strict/COMPILER.
+func TestCompiler_RunStrictFixtures(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.planout")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	generated, err := filepath.Glob("testdata/strict/*.planout")
+	require.NoError(t, err)
+	require.NotEmpty(t, generated)
+
+	for _, file := range append(files, generated...) {
+		t.Run(file, func(t *testing.T) {
+			input, err := ioutil.ReadFile(file)
+			require.NoError(t, err)
+
+			actual, err := New(parser.New(lexer.New(string(input)))).WithStrict().Run()
+			require.NoError(t, err)
+
+			expected, err := ioutil.ReadFile(strings.TrimSuffix(file, ".planout") + ".json")
+			require.NoError(t, err, "run node testdata/strict/generate.js with the official compiler")
+			// some of the files end with a new line, which JSON.stringify does not write
+			require.Equal(t, string(bytes.TrimSpace(expected)), string(actual))
+		})
+	}
+
+	_, err = ioutil.ReadFile("testdata/strict/COMPILER")
+	require.NoError(t, err, "run node testdata/strict/generate.js with the official compiler")
+}
+
+func TestCompiler_RunStrictErrors(t *testing.T) {
+	input := "# comment\n" +
+		"button.color = 1;\n" +
+		"x = 1+1;\n" +
+		"y = 'it\\'s' + z -1; # trailing\n" +
+		"switch {\n" +
+		"  a => b = 1;\n" +
+		"}\n" +
+		"w = ;"
+	_, err := New(parser.New(lexer.New(input))).WithStrict().Run()
+	require.IsType(t, ParserErrors{}, err)
+
+	var actual []string
+	for _, err := range err.(ParserErrors) {
+		actual = append(actual, err.Error())
+	}
+	require.Equal(t, []string{
+		"1:1: comments are not supported by the official compiler",
+		"2:1: dots in identifiers are not supported by the official compiler",
+		`3:6: the official compiler requires a space after "+"`,
+		"4:8: escape sequences in strings are not supported by the official compiler",
+		`4:17: the official compiler requires a space after "-"`,
+		"4:21: comments are not supported by the official compiler",
+		"6:8: assignments in switch cases are not supported by the official compiler",
+		"8:5: no prefix parse function for token type ;",
+	}, actual)
+
+	// without the strict mode, only the syntax error is reported
+	_, err = New(parser.New(lexer.New(input))).Run()
+	require.Len(t, err.(ParserErrors), 1)
+}
@@ -0,0 +1,403 @@
+// Package decompiler turns compiled PlanOut JSON back into PlanOut source.
+// It reads the code produced by compiler.Compiler.Run as well as the code of the official compiler,
+// and writes expressions with only the parentheses the parser needs.
+package decompiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/biased-unit/planout-golang/compiler/ast"
+	"github.com/biased-unit/planout-golang/compiler/parser"
+	"github.com/biased-unit/planout-golang/compiler/token"
+)
+
+// primary is the precedence of literals, variables, function calls and parenthesized expressions
+const primary = parser.INDEX + 1
+
+type operator struct {
+	symbol     string
+	precedence int
+}
+
+// operators compiled to {"op", "left", "right"}
+var leftRightOperators = map[string]operator{
+	"%":      {"%", parser.PROD},
+	"/":      {"/", parser.PROD},
+	">":      {">", parser.COMPARISON},
+	"<":      {"<", parser.COMPARISON},
+	">=":     {">=", parser.COMPARISON},
+	"<=":     {"<=", parser.COMPARISON},
+	"equals": {"==", parser.COMPARISON},
+}
+
+// operators compiled to {"op", "values": [left, right]}
+var valuesOperators = map[string]operator{
+	"sum":      {"+", parser.SUM},
+	"product":  {"*", parser.PROD},
+	"and":      {"&&", parser.LOGICAL},
+	"or":       {"||", parser.LOGICAL},
+	"coalesce": {"??", parser.LOGICAL},
+}
+
+// Decompile returns the PlanOut source of compiled code
+func Decompile(code []byte) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(code))
+	dec.UseNumber()
+	program, err := ast.DecodeJSON(dec)
+	if err != nil {
+		return "", fmt.Errorf("invalid PlanOut code: %w", err)
+	}
+
+	d := &decompiler{}
+	if obj, ok := program.(*ast.JSONObject); ok && len(obj.Keys) == 0 {
+		return "", nil // the compiler turns an empty script into {}
+	}
+	if err := d.statements(program); err != nil {
+		return "", err
+	}
+	return d.out.String(), nil
+}
+
+// DecompileExpression returns the PlanOut source of a compiled expression
+func DecompileExpression(code []byte) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(code))
+	dec.UseNumber()
+	expr, err := ast.DecodeJSON(dec)
+	if err != nil {
+		return "", fmt.Errorf("invalid PlanOut code: %w", err)
+	}
+	d := &decompiler{}
+	return d.expression(expr, parser.LOWEST, parser.LOWEST)
+}
+
+type decompiler struct {
+	out    strings.Builder
+	indent int
+	// pending is written at the start of the next line, after the indentation
+	pending string
+}
+
+func (d *decompiler) line(text string) {
+	d.out.WriteString(strings.Repeat("  ", d.indent))
+	d.out.WriteString(d.pending)
+	d.out.WriteString(text)
+	d.out.WriteString("\n")
+	d.pending = ""
+}
+
+// statements writes a statement, or each statement of a seq
+func (d *decompiler) statements(code interface{}) error {
+	obj, ok := code.(*ast.JSONObject)
+	if !ok {
+		return fmt.Errorf("expecting a statement, got %s", marshal(code))
+	}
+
+	switch opOf(obj) {
+	default:
+		return fmt.Errorf("%s cannot be decompiled to a statement", marshal(code))
+	case "seq":
+		seq, ok := obj.Get("seq").([]interface{})
+		if !ok {
+			return fmt.Errorf("expecting a list of statements in %s", marshal(code))
+		}
+		for _, stmt := range seq {
+			if err := d.statements(stmt); err != nil {
+				return err
+			}
+		}
+	case "set":
+		name, _ := obj.Get("var").(string)
+		if !isIdentifier(name) {
+			return fmt.Errorf("cannot assign to %s", marshal(obj.Get("var")))
+		}
+		value, err := d.expression(obj.Get("value"), parser.LOWEST, parser.LOWEST)
+		if err != nil {
+			return err
+		}
+		d.line(name + " = " + value + ";")
+	case "return":
+		value, err := d.expression(obj.Get("value"), parser.LOWEST, parser.LOWEST)
+		if err != nil {
+			return err
+		}
+		d.line("return " + value + ";")
+	case "cond":
+		return d.ifStatement(obj)
+	case "switch":
+		return d.switchStatement(obj)
+	}
+	return nil
+}
+
+// ifStatement writes a chain of if/else statements. A last condition of true is the else block.
+func (d *decompiler) ifStatement(obj *ast.JSONObject) error {
+	conds, ok := obj.Get("cond").([]interface{})
+	if !ok {
+		return fmt.Errorf("expecting a list of conditions in %s", marshal(obj))
+	}
+
+	for i, c := range conds {
+		cond, ok := c.(*ast.JSONObject)
+		if !ok {
+			return fmt.Errorf("expecting a condition, got %s", marshal(c))
+		}
+
+		if i == len(conds)-1 && i > 0 && cond.Get("if") == true {
+			d.line("} else {")
+		} else {
+			predicate, err := d.expression(cond.Get("if"), parser.LOWEST, parser.LOWEST)
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				d.line("if (" + predicate + ") {")
+			} else {
+				d.line("} else if (" + predicate + ") {")
+			}
+		}
+
+		if then := cond.Get("then"); then != nil {
+			d.indent++
+			if err := d.statements(then); err != nil {
+				return err
+			}
+			d.indent--
+		}
+	}
+
+	if len(conds) > 0 {
+		d.line("}")
+	}
+	return nil
+}
+
+func (d *decompiler) switchStatement(obj *ast.JSONObject) error {
+	cases, ok := obj.Get("cases").([]interface{})
+	if !ok {
+		return fmt.Errorf("expecting a list of cases in %s", marshal(obj))
+	}
+
+	d.line("switch {")
+	d.indent++
+	for _, c := range cases {
+		cs, ok := c.(*ast.JSONObject)
+		if !ok {
+			return fmt.Errorf("expecting a case, got %s", marshal(c))
+		}
+		cond := cs.Get("condidion") // This typo is present in the language definition
+		if cond == nil {
+			cond = cs.Get("condition")
+		}
+		condition, err := d.expression(cond, parser.LOWEST, parser.LOWEST)
+		if err != nil {
+			return err
+		}
+
+		// a case holds a single statement
+		result := cs.Get("result")
+		if seq, ok := result.(*ast.JSONObject); ok && opOf(seq) == "seq" {
+			if stmts, _ := seq.Get("seq").([]interface{}); len(stmts) == 1 {
+				result = stmts[0]
+			} else {
+				return fmt.Errorf("expecting a single statement in the case %s", marshal(c))
+			}
+		}
+		d.pending = condition + " => "
+		if err := d.statements(result); err != nil {
+			return err
+		}
+	}
+	d.indent--
+	d.line("}")
+	return nil
+}
+
+// form is the way an expression is written: its precedence, and a function writing it.
+// The operand of a prefix operator extends over all the operators of higher precedence
+// that follow it, so a prefix expression needs parentheses when such an operator follows.
+type form struct {
+	precedence int
+	prefix     bool
+	write      func(follow int) (string, error)
+}
+
+func text(precedence int, s string) form {
+	return form{precedence: precedence, write: func(int) (string, error) { return s, nil }}
+}
+
+// expression writes code as an expression of at least the given precedence.
+// follow is the precedence of the operator written right after it, LOWEST if there is none.
+func (d *decompiler) expression(code interface{}, precedence, follow int) (string, error) {
+	f, err := d.form(code)
+	if err != nil {
+		return "", err
+	}
+	if f.prefix && follow > f.precedence || !f.prefix && f.precedence < precedence {
+		s, err := f.write(parser.LOWEST)
+		return "(" + s + ")", err
+	}
+	return f.write(follow)
+}
+
+func (d *decompiler) form(code interface{}) (form, error) {
+	switch v := code.(type) {
+	case nil:
+		return text(primary, "null"), nil
+	case bool:
+		return text(primary, fmt.Sprint(v)), nil
+	case json.Number:
+		if strings.HasPrefix(v.String(), "-") {
+			f := text(parser.SUM, v.String())
+			f.prefix = true
+			return f, nil
+		}
+		return text(primary, v.String()), nil
+	case string:
+		return text(primary, marshal(v)), nil // JSON escape sequences are valid in strings
+	case []interface{}:
+		return d.array(v), nil
+	}
+
+	obj := code.(*ast.JSONObject)
+	op := opOf(obj)
+	if op == "" {
+		return text(primary, "@"+marshal(obj)), nil // a map without an operator
+	}
+
+	switch {
+	case op == "get" && has(obj, "var"):
+		if name, ok := obj.Get("var").(string); ok && isIdentifier(name) {
+			return text(primary, name), nil
+		}
+	case op == "array" && has(obj, "values"):
+		if values, ok := obj.Get("values").([]interface{}); ok {
+			return d.array(values), nil
+		}
+	case op == "literal" && has(obj, "value"):
+		return text(primary, "@"+marshal(obj.Get("value"))), nil
+	case op == "index" && has(obj, "base", "index"):
+		return form{precedence: parser.INDEX, write: func(int) (string, error) {
+			base, err := d.expression(obj.Get("base"), parser.INDEX, parser.INDEX)
+			if err != nil {
+				return "", err
+			}
+			index, err := d.expression(obj.Get("index"), parser.LOWEST, parser.LOWEST)
+			return base + "[" + index + "]", err
+		}}, nil
+	case op == "not" && has(obj, "value"):
+		if eq, ok := obj.Get("value").(*ast.JSONObject); ok && opOf(eq) == "equals" && has(eq, "left", "right") {
+			return d.binary(operator{"!=", parser.COMPARISON}, eq.Get("left"), eq.Get("right")), nil
+		}
+		return d.prefix("!", parser.NOT, obj.Get("value")), nil
+	case op == "negative" && has(obj, "value"):
+		return d.prefix("-", parser.SUM, obj.Get("value")), nil
+	case has(obj, "left", "right"):
+		if o, ok := leftRightOperators[op]; ok {
+			return d.binary(o, obj.Get("left"), obj.Get("right")), nil
+		}
+	case has(obj, "values"):
+		o, ok := valuesOperators[op]
+		values, isList := obj.Get("values").([]interface{})
+		if !ok || !isList || len(values) != 2 {
+			break
+		}
+		// a - b compiles to a + (-b)
+		if neg, ok := values[1].(*ast.JSONObject); ok && op == "sum" && opOf(neg) == "negative" && has(neg, "value") {
+			return d.binary(operator{"-", parser.SUM}, values[0], neg.Get("value")), nil
+		}
+		return d.binary(o, values[0], values[1]), nil
+	}
+	return d.call(obj)
+}
+
+func (d *decompiler) array(values []interface{}) form {
+	return form{precedence: primary, write: func(int) (string, error) {
+		list, err := d.list(values)
+		return "[" + list + "]", err
+	}}
+}
+
+func (d *decompiler) list(values []interface{}) (string, error) {
+	items := make([]string, len(values))
+	for i, v := range values {
+		item, err := d.expression(v, parser.LOWEST, parser.LOWEST)
+		if err != nil {
+			return "", err
+		}
+		items[i] = item
+	}
+	return strings.Join(items, ", "), nil
+}
+
+// binary writes a left-associative infix operator
+func (d *decompiler) binary(o operator, left, right interface{}) form {
+	return form{precedence: o.precedence, write: func(follow int) (string, error) {
+		l, err := d.expression(left, o.precedence, o.precedence)
+		if err != nil {
+			return "", err
+		}
+		r, err := d.expression(right, o.precedence+1, follow)
+		return l + " " + o.symbol + " " + r, err
+	}}
+}
+
+func (d *decompiler) prefix(symbol string, precedence int, operand interface{}) form {
+	return form{precedence: precedence, prefix: true, write: func(follow int) (string, error) {
+		s, err := d.expression(operand, precedence+1, follow)
+		return symbol + s, err
+	}}
+}
+
+// call writes any other operator as a function call, with positional arguments
+// for the "value" and "values" fields the compiler produces for them.
+func (d *decompiler) call(obj *ast.JSONObject) (form, error) {
+	op := opOf(obj)
+	if !isIdentifier(op) {
+		return form{}, fmt.Errorf("%s cannot be decompiled to an expression", marshal(obj))
+	}
+
+	var args []string
+	for _, key := range obj.Keys {
+		if key != "op" {
+			args = append(args, key)
+		}
+	}
+
+	return form{precedence: primary, write: func(int) (string, error) {
+		if len(args) == 1 && args[0] == "value" {
+			arg, err := d.expression(obj.Get("value"), parser.LOWEST, parser.LOWEST)
+			return op + "(" + arg + ")", err
+		}
+		if values, ok := obj.Get("values").([]interface{}); ok && len(args) == 1 && len(values) > 1 {
+			list, err := d.list(values)
+			return op + "(" + list + ")", err
+		}
+
+		named := make([]string, len(args))
+		for i, name := range args {
+			if !isIdentifier(name) {
+				return "", fmt.Errorf("%q is not a valid argument name of %s", name, op)
+			}
+			value, err := d.expression(obj.Get(name), parser.LOWEST, parser.LOWEST)
+			if err != nil {
+				return "", err
+			}
+			named[i] = name + "=" + value
+		}
+		return op + "(" + strings.Join(named, ", ") + ")", nil
+	}}, nil
+}
+
+// isIdentifier reports whether s can be written as a variable or function name
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		letter := 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z'
+		if !letter && (i == 0 || !('0' <= r && r <= '9' || r == '_' || r == '.')) {
+			return false
+		}
+	}
+	return s != "" && token.Lookup(s) == token.IDENT
+}
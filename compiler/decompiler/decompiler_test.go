@@ -0,0 +1,135 @@
+package decompiler
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/biased-unit/planout-golang/compiler"
+	"github.com/biased-unit/planout-golang/compiler/lexer"
+	"github.com/biased-unit/planout-golang/compiler/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func compile(t *testing.T, script string) []byte {
+	code, err := compiler.New(parser.New(lexer.New(script))).Run()
+	require.NoError(t, err, script)
+	return code
+}
+
+func TestDecompile_RoundTrip(t *testing.T) {
+	files, err := filepath.Glob("../testdata/*.json")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			code, err := ioutil.ReadFile(file)
+			require.NoError(t, err)
+
+			// the decompiled script compiles back to the code of the fixture
+			script, err := Decompile(code)
+			require.NoError(t, err)
+			require.JSONEq(t, string(code), string(compile(t, script)), script)
+
+			// and so does the code compiled from the source of the fixture
+			source, err := ioutil.ReadFile(file[:len(file)-len(".json")] + ".planout")
+			require.NoError(t, err)
+			code = compile(t, string(source))
+			script, err = Decompile(code)
+			require.NoError(t, err)
+			require.JSONEq(t, string(code), string(compile(t, script)), script)
+		})
+	}
+}
+
+func TestDecompile(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"statements",
+			"x = uniformChoice(choices=['a', 'b'], unit=userid); if (x == 'a') { y = 1; } else if (x) { y = 2; } else { return false; }",
+			"x = uniformChoice(choices=[\"a\", \"b\"], unit=userid);\nif (x == \"a\") {\n  y = 1;\n} else if (x) {\n  y = 2;\n} else {\n  return false;\n}\n",
+		},
+		{
+			"precedence and associativity",
+			"x = (a + b) * c - (d - e) / 2 % f;",
+			"x = (a + b) * c - (d - e) / 2 % f;\n",
+		},
+		{
+			"redundant parentheses",
+			"x = ((a * b) + (c[0]));",
+			"x = a * b + c[0];\n",
+		},
+		{
+			"prefix operators",
+			"x = !a || b; y = (!a) || b; z = a && !b; w = (a && !b) || c; v = -(a + b) * -c; u = (-2) * a;",
+			"x = !a || b;\ny = (!a) || b;\nz = a && !b;\nw = a && (!b) || c;\nv = -(a + b) * -c;\nu = (-2) * a;\n",
+		},
+		{
+			"not equals and indexes",
+			"x = a != b[1][k]; y = (a + b)[0];",
+			"x = a != b[1][k];\ny = (a + b)[0];\n",
+		},
+		{
+			"calls and literals",
+			`x = f(); y = g(a); z = h(a, b); w = @{"a": [1, 2.5]}; v = [null, true, 'say "hi"', 'a\nb'];`,
+			"x = f();\ny = g(a);\nz = h(a, b);\nw = @{\"a\":[1,2.5]};\nv = [null, true, \"say \\\"hi\\\"\", \"a\\nb\"];\n",
+		},
+		{
+			"switch",
+			"switch { a => x = 1; b => if (c) { x = 2; } }",
+			"switch {\n  a => x = 1;\n  b => if (c) {\n    x = 2;\n  }\n}\n",
+		},
+		{
+			"empty script",
+			"",
+			"",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			code := compile(t, tc.input)
+			script, err := Decompile(code)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, script)
+			require.JSONEq(t, string(code), string(compile(t, script)))
+		})
+	}
+}
+
+func TestDecompile_OfficialCompiler(t *testing.T) {
+	// the official compiler keeps the arguments in the order of the source
+	code := `{"op":"seq","seq":[
+		{"op":"set","var":"b","value":{"choices":{"op":"array","values":["x","y"]},"unit":{"op":"get","var":"userid"},"op":"uniformChoice"}},
+		{"op":"set","var":"c","value":{"op":"sum","values":[{"op":"get","var":"a"},{"op":"negative","value":{"op":"get","var":"b"}}]}},
+		{"op":"set","var":"d","value":{"op":"sum","values":[1,2,3]}},
+		{"op":"set","var":"e","value":{"op":"get","var":"if"}}
+	]}`
+	script, err := Decompile([]byte(code))
+	require.NoError(t, err)
+	require.Equal(t, "b = uniformChoice(choices=[\"x\", \"y\"], unit=userid);\nc = a - b;\nd = sum(1, 2, 3);\ne = get(var=\"if\");\n", script)
+	require.JSONEq(t, code, string(compile(t, script)))
+}
+
+func TestDecompile_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"invalid JSON", `{"op":`, "invalid PlanOut code: EOF"},
+		{"expression statement", `{"op":"seq","seq":[{"op":"get","var":"x"}]}`, `{"op":"get","var":"x"} cannot be decompiled to a statement`},
+		{"invalid variable", `{"op":"set","var":"my var","value":1}`, `cannot assign to "my var"`},
+		{"invalid operator", `{"op":"set","var":"x","value":{"op":"-","left":1,"right":2}}`, `{"op":"-","left":1,"right":2} cannot be decompiled to an expression`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Decompile([]byte(tc.input))
+			require.EqualError(t, err, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package decompiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/biased-unit/planout-golang/compiler/ast"
+)
+
+// has reports whether the object has exactly the given keys besides "op"
+func has(obj *ast.JSONObject, keys ...string) bool {
+	if len(obj.Keys) != len(keys)+1 {
+		return false
+	}
+	for _, key := range keys {
+		if _, ok := obj.Values[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// opOf returns the operator of the object, or "" if it is not an operator
+func opOf(obj *ast.JSONObject) string {
+	op, _ := obj.Values["op"].(string)
+	return op
+}
+
+// marshal writes a value as compact JSON, without escaping HTML characters
+func marshal(v interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
@@ -0,0 +1,122 @@
+package compiler
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/biased-unit/planout-golang/compiler/token"
+)
+
+// Diagnostic is a compiler error located in the script. It marshals to JSON for editor integrations,
+// and String renders it with the offending line and a caret underline.
+type Diagnostic struct {
+	Message string         `json:"message"`
+	Start   token.Position `json:"start"`
+	End     token.Position `json:"end"`
+	Line    string         `json:"line"` // text of the line the error starts on
+}
+
+// positionedError is implemented by the errors of the lexer and the parser
+type positionedError interface {
+	error
+	Span() (token.Position, token.Position)
+	Message() string
+}
+
+// Diagnostics converts the error returned by Run for a script into diagnostics.
+// Errors without a position get a diagnostic with only a message.
+func Diagnostics(script string, err error) []Diagnostic {
+	if err == nil {
+		return nil
+	}
+
+	errs, ok := err.(ParserErrors)
+	if !ok {
+		errs = ParserErrors{err}
+	}
+
+	diagnostics := make([]Diagnostic, 0, len(errs))
+	for _, err := range errs {
+		perr, ok := err.(positionedError)
+		if !ok {
+			diagnostics = append(diagnostics, Diagnostic{Message: err.Error()})
+			continue
+		}
+		start, end := perr.Span()
+		diagnostics = append(diagnostics, Diagnostic{
+			Message: perr.Message(),
+			Start:   start,
+			End:     end,
+			Line:    lineAt(script, start.Offset),
+		})
+	}
+	return diagnostics
+}
+
+// FormatDiagnostics renders the error returned by Run for a script, one caret diagnostic after another
+func FormatDiagnostics(script string, err error) string {
+	var out strings.Builder
+	for _, d := range Diagnostics(script, err) {
+		out.WriteString(d.String())
+	}
+	return out.String()
+}
+
+// String renders the diagnostic as
+//
+//	2:5: expecting "=", got "foo"
+//	x   foo bar;
+//	    ^^^
+func (d Diagnostic) String() string {
+	if d.Start.Line == 0 {
+		return d.Message + "\n"
+	}
+
+	var out strings.Builder
+	out.WriteString(d.Start.String())
+	out.WriteString(": ")
+	out.WriteString(d.Message)
+	out.WriteString("\n")
+	out.WriteString(d.Line)
+	out.WriteString("\n")
+
+	// Keep the tabs of the line so that the caret lines up with the offending text
+	column := 1
+	for _, r := range d.Line {
+		if column >= d.Start.Column {
+			break
+		}
+		if r == '\t' {
+			out.WriteRune('\t')
+		} else {
+			out.WriteRune(' ')
+		}
+		column++
+	}
+
+	width := utf8.RuneCountInString(d.Line) - d.Start.Column + 1
+	if d.End.Line == d.Start.Line {
+		width = d.End.Column - d.Start.Column
+	}
+	if width < 1 {
+		width = 1
+	}
+	out.WriteString(strings.Repeat("^", width))
+	out.WriteString("\n")
+	return out.String()
+}
+
+// lineAt returns the line of the script containing the byte offset, without its line ending
+func lineAt(script string, offset int) string {
+	if offset > len(script) {
+		offset = len(script)
+	}
+	start := strings.LastIndexByte(script[:offset], '\n') + 1
+	end := strings.IndexByte(script[offset:], '\n')
+	if end < 0 {
+		end = len(script)
+	} else {
+		end += offset
+	}
+	return strings.TrimRight(script[start:end], "\r")
+}
@@ -0,0 +1,60 @@
+package compiler
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/biased-unit/planout-golang/compiler/lexer"
+	"github.com/biased-unit/planout-golang/compiler/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"parsing error after a tab",
+			"x = 1;\n\ty = f(a=1, 2);",
+			"2:13: expecting \"IDENTIFIER\", got \"2\"\n\ty = f(a=1, 2);\n\t           ^\n",
+		},
+		{
+			"lexing error spanning several characters",
+			"x = 'abc",
+			"1:5: EOF while scanning string\nx = 'abc\n    ^^^^\n",
+		},
+		{
+			"error at the end of the script",
+			"if (x) {\r\n  y = 1;",
+			"2:9: EOF while parsing block statement\n  y = 1;\n        ^\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(parser.New(lexer.New(tc.input))).Run()
+			require.Error(t, err)
+			require.Equal(t, tc.expected, FormatDiagnostics(tc.input, err))
+		})
+	}
+}
+
+func TestDiagnostics_JSON(t *testing.T) {
+	input := "x = 1;\ny = ;"
+	_, err := New(parser.New(lexer.New(input))).Run()
+	require.Error(t, err)
+
+	b, err := json.Marshal(Diagnostics(input, err))
+	require.NoError(t, err)
+	require.JSONEq(t, `[{
+		"message": "no prefix parse function for token type ;",
+		"start": {"offset": 11, "line": 2, "column": 5},
+		"end": {"offset": 12, "line": 2, "column": 6},
+		"line": "y = ;"
+	}]`, string(b))
+
+	// Errors without a position keep their message
+	require.Equal(t, "boom\n", FormatDiagnostics(input, errors.New("boom")))
+}
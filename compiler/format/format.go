@@ -0,0 +1,264 @@
+// Package format implements the canonical formatting of PlanOut scripts, in the manner of gofmt.
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/biased-unit/planout-golang/compiler"
+	"github.com/biased-unit/planout-golang/compiler/ast"
+	"github.com/biased-unit/planout-golang/compiler/decompiler"
+	"github.com/biased-unit/planout-golang/compiler/lexer"
+	"github.com/biased-unit/planout-golang/compiler/parser"
+	"github.com/biased-unit/planout-golang/compiler/token"
+)
+
+// Source formats a PlanOut script. Statements are written one per line, indented by two spaces
+// per block and ended by a semicolon, and expressions with canonical spacing, quoting and parentheses.
+// Comments are kept, as well as single blank lines between statements. Comments within a statement
+// are moved before it, and those between a closing brace and an else move to the end of the block.
+// A script that does not parse returns the compiler.ParserErrors.
+func Source(src []byte) ([]byte, error) {
+	script := string(src)
+	p := parser.New(lexer.New(script))
+	program := p.ParseProgram()
+	if p.HadError() {
+		return nil, compiler.ParserErrors(p.Errors())
+	}
+
+	pr := &printer{src: script, comments: scanComments(script), fresh: true}
+	for _, stmt := range program.Seq {
+		if err := pr.statement(stmt); err != nil {
+			return nil, err
+		}
+	}
+	pr.flushComments(len(script))
+	return pr.out.Bytes(), nil
+}
+
+type comment struct {
+	text        string
+	offset, end int
+}
+
+// scanComments returns the comments of the script. The lexer drops them,
+// so they are found in the whitespace between tokens.
+func scanComments(src string) []comment {
+	var comments []comment
+	lx := lexer.New(src)
+	from := 0
+	for {
+		tok := lx.NextToken()
+		gap := src[from:tok.Offset]
+		for i := strings.IndexByte(gap, '#'); i >= 0; i = strings.IndexByte(gap, '#') {
+			end := strings.IndexByte(gap[i:], '\n')
+			if end < 0 {
+				end = len(gap)
+			} else {
+				end += i
+			}
+			comments = append(comments, comment{
+				text:   strings.TrimRight(gap[i:end], " \t\r"),
+				offset: from + i,
+				end:    from + end,
+			})
+			from += end
+			gap = gap[end:]
+		}
+		if tok.Type == token.EOF || tok.Type == token.ERROR {
+			return comments
+		}
+		from = tok.End.Offset
+	}
+}
+
+type printer struct {
+	src      string
+	out      bytes.Buffer
+	indent   int
+	comments []comment // comments not printed yet
+	// pos is the offset in the script of the end of what was printed last
+	pos int
+	// fresh is set at the start of the script and of blocks, where blank lines are dropped
+	fresh bool
+	// pending is written at the start of the next line, after the indentation
+	pending string
+}
+
+// line prints a line of code whose last token ends at the given offset in the script, followed
+// by the comment directly after that token if there is one. A negative offset is for lines
+// without a known end, which take no comment.
+func (p *printer) line(text string, end int) {
+	p.out.WriteString(strings.Repeat("  ", p.indent))
+	p.out.WriteString(p.pending)
+	p.out.WriteString(text)
+	p.pending = ""
+	p.fresh = false
+
+	if end > p.pos {
+		p.pos = end
+	}
+	if end >= 0 && len(p.comments) > 0 {
+		c := p.comments[0]
+		if c.offset >= end && strings.Trim(p.src[end:c.offset], " \t\r") == "" {
+			p.out.WriteString(" " + c.text)
+			p.comments = p.comments[1:]
+			p.pos = c.end
+		}
+	}
+	p.out.WriteString("\n")
+}
+
+// separate prints a blank line if there is one in the script before the offset
+func (p *printer) separate(offset int) {
+	if offset <= p.pos {
+		return
+	}
+	if !p.fresh && p.pending == "" && strings.Count(p.src[p.pos:offset], "\n") > 1 {
+		p.out.WriteString("\n")
+	}
+	p.pos = offset
+}
+
+// flushComments prints the comments before the offset on lines of their own
+func (p *printer) flushComments(offset int) {
+	for len(p.comments) > 0 && p.comments[0].offset < offset {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		p.separate(c.offset)
+		p.out.WriteString(strings.Repeat("  ", p.indent))
+		p.out.WriteString(c.text)
+		p.out.WriteString("\n")
+		p.fresh = false
+		p.pos = c.end
+	}
+}
+
+func (p *printer) statement(stmt ast.Statement) error {
+	span := stmt.(ast.Node).SourceSpan()
+	p.flushComments(span.Start.Offset)
+	p.separate(span.Start.Offset)
+
+	switch s := stmt.(type) {
+	case *ast.AssignmentStatement:
+		p.flushComments(span.End.Offset)
+		value, err := expression(s.Value)
+		if err != nil {
+			return err
+		}
+		p.line(s.Var+" = "+value+";", span.End.Offset)
+	case *ast.ReturnStatement:
+		p.flushComments(span.End.Offset)
+		value, err := expression(s.Value)
+		if err != nil {
+			return err
+		}
+		p.line("return "+value+";", span.End.Offset)
+	case *ast.IfStatement:
+		return p.ifStatement(s)
+	case *ast.SwitchStatement:
+		return p.switchStatement(s)
+	}
+	return nil
+}
+
+func (p *printer) ifStatement(s *ast.IfStatement) error {
+	for i, cond := range s.Cond {
+		block := cond.Consequence
+		if i == len(s.Cond)-1 && i > 0 && cond.Condition == ast.Boolean(true) {
+			p.line("} else {", block.Start.Offset+1)
+		} else {
+			p.flushComments(block.Start.Offset)
+			predicate, err := expression(cond.Condition)
+			if err != nil {
+				return err
+			}
+			head := "if (" + predicate + ") {"
+			if i > 0 {
+				head = "} else " + head
+			}
+			p.line(head, block.Start.Offset+1)
+		}
+
+		// the comments before the else of the next branch end the block
+		closing := block.End.Offset - 1
+		if i < len(s.Cond)-1 {
+			closing = p.nextToken(block.End.Offset)
+		}
+		if err := p.block(block.Seq, closing); err != nil {
+			return err
+		}
+	}
+	p.line("}", s.End.Offset)
+	return nil
+}
+
+func (p *printer) switchStatement(s *ast.SwitchStatement) error {
+	p.line("switch {", -1)
+	p.indent++
+	p.fresh = true
+	for _, cs := range s.Cases {
+		p.flushComments(cs.Start.Offset)
+		p.separate(cs.Start.Offset)
+		if result, ok := cs.Result.(ast.Node); ok {
+			p.flushComments(result.SourceSpan().Start.Offset)
+		}
+		condition, err := expression(cs.Condition)
+		if err != nil {
+			return err
+		}
+		p.pending = condition + " => "
+		if err := p.statement(cs.Result); err != nil {
+			return err
+		}
+	}
+	p.flushComments(s.End.Offset - 1)
+	p.indent--
+	p.line("}", s.End.Offset)
+	return nil
+}
+
+// block prints the statements of a block, then the comments before its closing brace
+func (p *printer) block(seq []ast.Statement, closing int) error {
+	p.indent++
+	p.fresh = true
+	for _, stmt := range seq {
+		if err := p.statement(stmt); err != nil {
+			return err
+		}
+	}
+	p.flushComments(closing)
+	p.indent--
+	return nil
+}
+
+// nextToken returns the offset of the first token of the script at or after the offset
+func (p *printer) nextToken(offset int) int {
+	for offset < len(p.src) {
+		switch p.src[offset] {
+		case ' ', '\t', '\r', '\n':
+			offset++
+		case '#':
+			end := strings.IndexByte(p.src[offset:], '\n')
+			if end < 0 {
+				return len(p.src)
+			}
+			offset += end
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// expression writes an expression like the decompiler, which keeps only the parentheses it needs.
+// Named arguments keep their order.
+func expression(exp ast.Expression) (string, error) {
+	ast.KeepSourceOrder(exp)
+	code, err := json.Marshal(exp)
+	if err != nil {
+		return "", err
+	}
+	return decompiler.DecompileExpression(code)
+}
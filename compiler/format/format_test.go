@@ -0,0 +1,109 @@
+package format
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/biased-unit/planout-golang/compiler"
+	"github.com/biased-unit/planout-golang/compiler/lexer"
+	"github.com/biased-unit/planout-golang/compiler/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"spacing, quoting and semicolons",
+			"x=1 ;y =  f( choices=['a','b'],\n   unit=userid )\n",
+			"x = 1;\ny = f(choices=[\"a\", \"b\"], unit=userid);\n",
+		},
+		{
+			"indentation",
+			"if(a){\nb=1;if (c) {d=2;}}else if (e) {\n\n}else{return  false}",
+			"if (a) {\n  b = 1;\n  if (c) {\n    d = 2;\n  }\n} else if (e) {\n} else {\n  return false;\n}\n",
+		},
+		{
+			"parentheses",
+			"x = ((a * b) + c) * (d - (e - f));",
+			"x = (a * b + c) * (d - (e - f));\n",
+		},
+		{
+			"comments",
+			"# header\n\nx = 1;   # about x\ny = f(a=1, # inside y\n  b=2);\nif (x) { # about the if\n  z = 2;\n  # end of block\n}  # after the if\n# last\n",
+			"# header\n\nx = 1; # about x\n# inside y\ny = f(a=1, b=2);\nif (x) { # about the if\n  z = 2;\n  # end of block\n} # after the if\n# last\n",
+		},
+		{
+			"comments around else",
+			"if (a) { x = 1; } # after the if block\nelse { # about the else\n  y = 2;\n}\nif (b) {\n  z = 1;\n} # after the block\nelse if (c) {\n  z = 2;\n}",
+			"if (a) {\n  x = 1;\n  # after the if block\n} else { # about the else\n  y = 2;\n}\nif (b) {\n  z = 1;\n  # after the block\n} else if (c) {\n  z = 2;\n}\n",
+		},
+		{
+			"comments after a closing brace",
+			"if (a) { x = 1; } # after the if\nswitch { b => y = 1; } # after the switch\n",
+			"if (a) {\n  x = 1;\n} # after the if\nswitch {\n  b => y = 1;\n} # after the switch\n",
+		},
+		{
+			"blank lines",
+			"\n\nx = 1;\n\n\n\ny = 2;\nif (x) {\n\n  z = 3;\n\n}\n",
+			"x = 1;\n\ny = 2;\nif (x) {\n  z = 3;\n}\n",
+		},
+		{
+			"switch",
+			"switch {a => x = 1; # one\nb => x = 2;}",
+			"switch {\n  a => x = 1; # one\n  b => x = 2;\n}\n",
+		},
+		{
+			"only comments",
+			"# nothing yet\n",
+			"# nothing yet\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := Source([]byte(tc.input))
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(actual))
+
+			again, err := Source(actual)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(again))
+		})
+	}
+}
+
+func TestSource_Fixtures(t *testing.T) {
+	files, err := filepath.Glob("../testdata/*.planout")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			src, err := ioutil.ReadFile(file)
+			require.NoError(t, err)
+			expected, err := ioutil.ReadFile(file[:len(file)-len(".planout")] + ".json")
+			require.NoError(t, err)
+
+			formatted, err := Source(src)
+			require.NoError(t, err)
+			again, err := Source(formatted)
+			require.NoError(t, err)
+			require.Equal(t, string(formatted), string(again))
+
+			// formatting does not change the compiled code
+			actual, err := compiler.New(parser.New(lexer.New(string(formatted)))).Run()
+			require.NoError(t, err)
+			require.JSONEq(t, string(expected), string(actual))
+		})
+	}
+}
+
+func TestSource_Errors(t *testing.T) {
+	_, err := Source([]byte("x = ;\ny = 1;\nz = (2;"))
+	require.IsType(t, compiler.ParserErrors{}, err)
+	require.Len(t, err.(compiler.ParserErrors), 2)
+}
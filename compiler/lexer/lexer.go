@@ -4,8 +4,10 @@ package lexer
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"unicode"
+	"unicode/utf16"
 	"unicode/utf8"
 
 	"github.com/biased-unit/planout-golang/compiler/token"
@@ -18,28 +20,72 @@ const (
 )
 
 type Lexer struct {
-	input  string           // string to scan
-	state  stateFn          // current state
-	start  int              // start position of candidate token
-	line   int              // line number of candidate token
-	pos    int              // current position of the input
-	width  int              // width of last rune read
-	tokens chan token.Token // buffer for tokens
+	input      string           // string to scan
+	state      stateFn          // current state
+	start      int              // start position of candidate token
+	pos        int              // current position of the input
+	width      int              // width of last rune read
+	lineStarts []int            // byte offsets at which each line starts
+	last       token.Position   // position last computed, to count the columns of the next from it
+	tokens     chan token.Token // buffer for tokens
+	extensions []Extension      // syntax lexed so far that the official compiler does not accept
+}
+
+// Extension is a part of a script using syntax that the official PlanOut compiler does not accept
+type Extension struct {
+	Start, End token.Position
+	Feature    string // the syntax, such as "comments"
 }
 
 // New returns a new Lexer for lexing a PlanOut script.
 func New(input string) *Lexer {
 	s := &Lexer{
-		input:  input,
-		state:  lexCode,
-		tokens: make(chan token.Token, len(input)), // buffer is same size as input to avoid deadlock
-		line:   1,
+		input:      input,
+		state:      lexCode,
+		lineStarts: []int{0},
+		tokens:     make(chan token.Token, len(input)), // buffer is same size as input to avoid deadlock
+	}
+	for i := 0; i < len(input); i++ {
+		if input[i] == '\n' {
+			s.lineStarts = append(s.lineStarts, i+1)
+		}
 	}
 	return s
 }
 
+// Position returns the line and column of a byte offset in the input. The runes of the line are counted
+// from the position last computed when it is before the offset on the same line, so that computing the
+// positions of the tokens of a long line in order takes linear time.
+func (lx *Lexer) Position(offset int) token.Position {
+	line := sort.Search(len(lx.lineStarts), func(i int) bool { return lx.lineStarts[i] > offset }) - 1
+	from, column := lx.lineStarts[line], 1
+	if lx.last.Line == line+1 && lx.last.Offset <= offset {
+		from, column = lx.last.Offset, lx.last.Column
+	}
+	lx.last = token.Position{
+		Offset: offset,
+		Line:   line + 1,
+		Column: column + utf8.RuneCountInString(lx.input[from:offset]),
+	}
+	return lx.last
+}
+
+// token builds a token of the given type and value spanning the input from start to pos
+func (lx *Lexer) token(t token.Type, val string) token.Token {
+	start := lx.Position(lx.start)
+	return token.Token{
+		Type:   t,
+		Val:    val,
+		Line:   start.Line,
+		Column: start.Column,
+		Offset: start.Offset,
+		End:    lx.Position(lx.pos),
+	}
+}
+
 // NextToken is used to iterate over tokens in the PlanOut script.
-// Callers should stop iterating when receiving a token.ERROR or token.EOF token type.
+// After a token.ERROR, lexing resumes past the offending text so that every error in the
+// script can be reported. Callers should stop iterating when receiving a token.EOF token type.
 func (lx *Lexer) NextToken() token.Token {
 Loop:
 	for {
@@ -53,7 +99,19 @@ Loop:
 			lx.state = lx.state(lx)
 		}
 	}
-	return token.Token{Type: token.EOF, Line: lx.line}
+	lx.start = lx.pos
+	return lx.token(token.EOF, "")
+}
+
+// Extensions returns the parts of the script lexed so far that use syntax the official compiler does not accept:
+// comments, escape sequences in strings and dots in identifiers
+func (lx *Lexer) Extensions() []Extension {
+	return lx.extensions
+}
+
+// extension records the input from start to end as using syntax the official compiler does not accept
+func (lx *Lexer) extension(feature string, start, end int) {
+	lx.extensions = append(lx.extensions, Extension{Start: lx.Position(start), End: lx.Position(end), Feature: feature})
 }
 
 type stateFn func(*Lexer) stateFn
@@ -64,15 +122,12 @@ func lexCode(lx *Lexer) stateFn {
 		switch {
 		default:
 			return lx.errorf("unexpected character: '%s'", lx.input[lx.start:lx.pos])
-		case isSpace(r):
-			lx.ignore()
-		case isEndOfLine(r):
+		case isSpace(r) || isEndOfLine(r):
 			lx.ignore()
-			lx.line += 1
-		case unicode.IsLetter(r):
+		case isLetter(r):
 			lx.backup()
 			return lexIdentifier
-		case unicode.IsDigit(r):
+		case isDigit(r):
 			lx.backup()
 			return lexNumber
 		case r == '\'' || r == '"':
@@ -129,51 +184,125 @@ func lexCode(lx *Lexer) stateFn {
 	}
 }
 
+// errorf emits an error token for the pending input, then skips it and resumes lexing
 func (lx *Lexer) errorf(format string, args ...interface{}) stateFn {
-	lx.tokens <- token.Token{
-		Type: token.ERROR,
-		Val:  fmt.Sprintf(format, args...),
-		Line: lx.line,
-	}
-	return nil
+	lx.emitValue(token.ERROR, fmt.Sprintf(format, args...))
+	return lexCode
 }
 
-// lexString scans until it finds a closeQuote, then emits a STRING token
-// emits an error if a new line or EOF is encountered before closeQuote is found
+// lexString scans until it finds a closeQuote, then emits a STRING token with the escape sequences replaced
+// emits an error if a new line or EOF is encountered before closeQuote is found, or for an invalid escape sequence
 func lexString(closeQuote rune) stateFn {
 	return func(lx *Lexer) stateFn {
-		lx.ignore() // ignore the open quote
-
+		var value strings.Builder
+		var escapeErr error
 		for {
 			switch r := lx.next(); {
 			case r == eof:
 				return lx.errorf("EOF while scanning string")
 			case isEndOfLine(r):
 				return lx.errorf("new line while scanning string")
+			case r == '\\':
+				// keep scanning to the closing quote, so that the rest of the string is not lexed as code
+				start := lx.pos - lx.width
+				if s, err := lx.escape(); err != nil && escapeErr == nil {
+					escapeErr = err
+				} else {
+					value.WriteString(s)
+				}
+				lx.extension("escape sequences in strings", start, lx.pos)
 			case r == closeQuote:
-				lx.backup() // don't include the close quote in emitted string
-				lx.emit(token.STRING)
-
-				lx.next() // now skip the close quote
-				lx.ignore()
+				if escapeErr != nil {
+					return lx.errorf("%s", escapeErr)
+				}
+				// the token spans the quotes, but its value doesn't include them
+				lx.emitValue(token.STRING, value.String())
 				return lexCode
+			default:
+				value.WriteString(lx.input[lx.pos-lx.width : lx.pos])
 			}
 		}
 	}
 }
 
+// escape reads an escape sequence after its backslash and returns the text it stands for.
+// The escape sequences are those of JSON strings, and \' in both single- and double-quoted strings.
+func (lx *Lexer) escape() (string, error) {
+	switch r := lx.next(); r {
+	case '"', '\'', '\\', '/':
+		return string(r), nil
+	case 'b':
+		return "\b", nil
+	case 'f':
+		return "\f", nil
+	case 'n':
+		return "\n", nil
+	case 'r':
+		return "\r", nil
+	case 't':
+		return "\t", nil
+	case 'u':
+		r, ok := lx.hex4()
+		if !ok {
+			hex := lx.input[lx.pos:]
+			if len(hex) > 4 {
+				hex = hex[:4]
+			}
+			return "", fmt.Errorf("invalid unicode escape sequence: \\u%s", hex)
+		}
+		// a character outside of the basic multilingual plane is written as a UTF-16 surrogate pair
+		if utf16.IsSurrogate(r) && strings.HasPrefix(lx.input[lx.pos:], `\u`) {
+			pos := lx.pos
+			lx.pos += 2
+			if low, ok := lx.hex4(); ok && utf16.DecodeRune(r, low) != unicode.ReplacementChar {
+				return string(utf16.DecodeRune(r, low)), nil
+			}
+			lx.pos = pos
+		}
+		return string(r), nil
+	case eof:
+		return "", nil // reported as an unterminated string
+	default:
+		if isEndOfLine(r) {
+			lx.backup()
+			return "", nil // reported as an unterminated string
+		}
+		return "", fmt.Errorf("invalid escape sequence: \\%c", r)
+	}
+}
+
+// hex4 reads the four hexadecimal digits of a unicode escape sequence
+func (lx *Lexer) hex4() (rune, bool) {
+	if len(lx.input)-lx.pos < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range lx.input[lx.pos : lx.pos+4] {
+		switch {
+		case '0' <= c && c <= '9':
+			r = r<<4 | (c - '0')
+		case 'a' <= c && c <= 'f':
+			r = r<<4 | (c - 'a' + 10)
+		case 'A' <= c && c <= 'F':
+			r = r<<4 | (c - 'A' + 10)
+		default:
+			return 0, false
+		}
+	}
+	lx.pos += 4
+	return r, true
+}
+
 // lexComment scans until a new line OR EOF is found, then ignores everything
 func lexComment(lx *Lexer) stateFn {
 	for {
-		switch r := lx.next(); {
-		case r == eof:
+		switch r := lx.peek(); {
+		case r == eof || isEndOfLine(r):
+			lx.extension("comments", lx.start, lx.pos)
 			lx.ignore()
-			return nil
-		case isEndOfLine(r):
-			lx.ignore()
-			lx.line += 1
 			return lexCode
 		}
+		lx.next()
 	}
 }
 
@@ -183,6 +312,9 @@ func lexIdentifier(lx *Lexer) stateFn {
 	lx.acceptRun(alphabet + digits + "_" + ".") // after that accept letters, numbers, or underscores
 
 	tokType := lx.keywordOrIdent()
+	if strings.Contains(lx.input[lx.start:lx.pos], ".") {
+		lx.extension("dots in identifiers", lx.start, lx.pos)
+	}
 
 	lx.emit(tokType)
 
@@ -209,19 +341,22 @@ func lexEquals(lx *Lexer) stateFn {
 // emits an error if the decoding fails
 func lexJSON(lx *Lexer) stateFn {
 
-	lx.ignore() // ignore the @ symbol
-
-	dec := json.NewDecoder(strings.NewReader(lx.input[lx.start:]))
+	// the token spans the @ symbol, but its value doesn't include it
+	dec := json.NewDecoder(strings.NewReader(lx.input[lx.pos:]))
 
 	var jsonLit interface{}
 	if err := dec.Decode(&jsonLit); err != nil {
-		lx.errorf("failed to parse JSON literal: %s", err.Error())
+		// skip the rest of the statement rather than lexing the invalid JSON as code
+		for r := lx.peek(); r != eof && r != ';' && !isEndOfLine(r); r = lx.peek() {
+			lx.next()
+		}
+		return lx.errorf("failed to parse JSON literal: %s", err.Error())
 	}
 
 	offset := dec.InputOffset()
 	lx.pos += int(offset)
 
-	lx.emit(token.JSON)
+	lx.emitValue(token.JSON, lx.input[lx.start+1:lx.pos])
 
 	return lexCode
 }
@@ -335,11 +470,12 @@ func (lx *Lexer) acceptRun(valid string) {
 // emit sends a token to the tokens channel with the specified type and value extracted from
 // the input string. If given an identifier token, will check if the
 func (lx *Lexer) emit(t token.Type) {
-	lx.tokens <- token.Token{
-		Type: t,
-		Val:  lx.input[lx.start:lx.pos],
-		Line: lx.line,
-	}
+	lx.emitValue(t, lx.input[lx.start:lx.pos])
+}
+
+// emitValue sends a token spanning the pending input, with a value other than its text
+func (lx *Lexer) emitValue(t token.Type, val string) {
+	lx.tokens <- lx.token(t, val)
 	lx.start = lx.pos
 }
 
@@ -381,6 +517,16 @@ func isAlphaNumeric(r rune) bool {
 	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
 }
 
+// isLetter reports whether r can start an identifier. Identifiers are ASCII, other letters are
+// unexpected characters.
+func isLetter(r rune) bool {
+	return strings.ContainsRune(alphabet, r)
+}
+
+func isDigit(r rune) bool {
+	return strings.ContainsRune(digits, r)
+}
+
 func isSpace(r rune) bool {
 	return r == ' ' || r == '\t'
 }
@@ -395,6 +395,66 @@ z = b[22];
 				{Type: token.ERROR, Val: "bad number syntax: \"19.3_\""},
 			},
 		},
+		{
+			name:  "string escape sequences",
+			input: `"a\"b" 'a\'b' "\\ \/ \b\f\n\r\t" '\u00e9\u4E2D\ud83d\ude00' "it's" 'say "hi"'`,
+			expected: []token.Token{
+				{Type: token.STRING, Val: `a"b`},
+				{Type: token.STRING, Val: "a'b"},
+				{Type: token.STRING, Val: "\\ / \b\f\n\r\t"},
+				{Type: token.STRING, Val: "é中😀"},
+				{Type: token.STRING, Val: "it's"},
+				{Type: token.STRING, Val: `say "hi"`},
+				{Type: token.EOF, Val: ""},
+			},
+		},
+		{
+			name:  "invalid escape sequences",
+			input: `"a\qb" x "\u12g4" "\ud83d" "a\`,
+			expected: []token.Token{
+				{Type: token.ERROR, Val: `invalid escape sequence: \q`},
+				{Type: token.IDENT, Val: "x"},
+				{Type: token.ERROR, Val: `invalid unicode escape sequence: \u12g4`},
+				{Type: token.STRING, Val: "\uFFFD"},
+				{Type: token.ERROR, Val: "EOF while scanning string"},
+				{Type: token.EOF, Val: ""},
+			},
+		},
+		{
+			name:  "non-ASCII letters and digits",
+			input: "x = é; y = ٣;",
+			expected: []token.Token{
+				{Type: token.IDENT, Val: "x"},
+				{Type: token.ASSIGN, Val: "="},
+				{Type: token.ERROR, Val: "unexpected character: 'é'"},
+				{Type: token.SEMICOLON, Val: ";"},
+				{Type: token.IDENT, Val: "y"},
+				{Type: token.ASSIGN, Val: "="},
+				{Type: token.ERROR, Val: "unexpected character: '٣'"},
+				{Type: token.SEMICOLON, Val: ";"},
+				{Type: token.EOF, Val: ""},
+			},
+		},
+		{
+			name:  "lexing resumes after an error",
+			input: "a = 1 $ 2;\nb = @{bad;\nc = 'x",
+			expected: []token.Token{
+				{Type: token.IDENT, Val: "a"},
+				{Type: token.ASSIGN, Val: "="},
+				{Type: token.NUMBER, Val: "1"},
+				{Type: token.ERROR, Val: "unexpected character: '$'"},
+				{Type: token.NUMBER, Val: "2"},
+				{Type: token.SEMICOLON, Val: ";"},
+				{Type: token.IDENT, Val: "b"},
+				{Type: token.ASSIGN, Val: "="},
+				{Type: token.ERROR, Val: "failed to parse JSON literal: invalid character 'b' looking for beginning of object key string"},
+				{Type: token.SEMICOLON, Val: ";"},
+				{Type: token.IDENT, Val: "c"},
+				{Type: token.ASSIGN, Val: "="},
+				{Type: token.ERROR, Val: "EOF while scanning string"},
+				{Type: token.EOF, Val: ""},
+			},
+		},
 	}
 	for _, testCase := range tests {
 		t.Run(testCase.name, func(t *testing.T) {
@@ -414,3 +474,85 @@ z = b[22];
 		})
 	}
 }
+
+func TestLexer_Positions(t *testing.T) {
+	input := "x = 'héllo';\r\ny = @{\n  \"a\": 1\n} + ze;"
+	expected := []struct {
+		val             string
+		line, column    int
+		offset, end     int
+		endLine, endCol int
+	}{
+		{"x", 1, 1, 0, 1, 1, 2},
+		{"=", 1, 3, 2, 3, 1, 4},
+		{"héllo", 1, 5, 4, 12, 1, 12},
+		{";", 1, 12, 12, 13, 1, 13},
+		{"y", 2, 1, 15, 16, 2, 2},
+		{"=", 2, 3, 17, 18, 2, 4},
+		{"{\n  \"a\": 1\n}", 2, 5, 19, 32, 4, 2},
+		{"+", 4, 3, 33, 34, 4, 4},
+		{"ze", 4, 5, 35, 37, 4, 7},
+		{";", 4, 7, 37, 38, 4, 8},
+		{"", 4, 8, 38, 38, 4, 8},
+	}
+
+	l := New(input)
+	for i, e := range expected {
+		tok := l.NextToken()
+		if tok.Val != e.val || tok.Line != e.line || tok.Column != e.column || tok.Offset != e.offset ||
+			tok.End.Offset != e.end || tok.End.Line != e.endLine || tok.End.Column != e.endCol {
+			t.Errorf("token[%d] wrong. expected=%q at %d:%d (offset %d) to %d:%d (offset %d), got=%q at %s (offset %d) to %s (offset %d)",
+				i, e.val, e.line, e.column, e.offset, e.endLine, e.endCol, e.end,
+				tok.Val, tok.Pos(), tok.Offset, tok.End, tok.End.Offset)
+		}
+	}
+}
+
+func TestLexer_Position(t *testing.T) {
+	l := New("a = 'é';\nbé = 'ü' + 'x';")
+	for _, e := range []struct {
+		offset, line, column int
+	}{
+		{21, 2, 10},
+		{7, 1, 7},
+		{8, 1, 8},
+		{13, 2, 3},
+		{19, 2, 8},
+		{10, 2, 1},
+		{26, 2, 15},
+		{21, 2, 10},
+	} {
+		if pos := l.Position(e.offset); pos.Line != e.line || pos.Column != e.column || pos.Offset != e.offset {
+			t.Errorf("offset %d. expected=%d:%d, got=%s (offset %d)", e.offset, e.line, e.column, pos, pos.Offset)
+		}
+	}
+}
+
+func TestLexer_Extensions(t *testing.T) {
+	input := "a.b = 'x\\n' # note\n# last"
+	expected := []struct {
+		feature    string
+		start, end int
+	}{
+		{"dots in identifiers", 0, 3},
+		{"escape sequences in strings", 8, 10},
+		{"comments", 12, 18},
+		{"comments", 19, 25},
+	}
+
+	l := New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+
+	extensions := l.Extensions()
+	if len(extensions) != len(expected) {
+		t.Fatalf("wrong number of extensions. expected=%d, got=%d", len(expected), len(extensions))
+	}
+	for i, e := range expected {
+		ext := extensions[i]
+		if ext.Feature != e.feature || ext.Start.Offset != e.start || ext.End.Offset != e.end {
+			t.Errorf("extension[%d] wrong. expected=%q at offsets %d to %d, got=%q at offsets %d to %d",
+				i, e.feature, e.start, e.end, ext.Feature, ext.Start.Offset, ext.End.Offset)
+		}
+	}
+}
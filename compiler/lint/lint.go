@@ -0,0 +1,224 @@
+// Package lint reports likely mistakes in PlanOut scripts that compile cleanly, such as a random
+// operator without a unit, or a variable read before it is assigned.
+package lint
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/biased-unit/planout-golang/compiler"
+	"github.com/biased-unit/planout-golang/compiler/ast"
+	"github.com/biased-unit/planout-golang/compiler/lexer"
+	"github.com/biased-unit/planout-golang/compiler/parser"
+	"github.com/biased-unit/planout-golang/compiler/token"
+)
+
+// The rules checked by the linter
+const (
+	MissingUnit          = "missing-unit"           // a random operator without a unit
+	SaltReuse            = "salt-reuse"             // two parameters hashed with the same salt
+	ReadBeforeAssignment = "read-before-assignment" // a variable read before the statement assigning it
+	Unreachable          = "unreachable"            // statements after a return
+	WeightsMismatch      = "weights-mismatch"       // weights and choices of different lengths
+)
+
+// Warning is a likely mistake in a script
+type Warning struct {
+	Rule    string         `json:"rule"`
+	Message string         `json:"message"`
+	Start   token.Position `json:"start"`
+	End     token.Position `json:"end"`
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s (%s)", w.Start, w.Message, w.Rule)
+}
+
+// Source parses a script and checks it. A script that does not parse returns the compiler.ParserErrors.
+func Source(src []byte) ([]Warning, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if p.HadError() {
+		return nil, compiler.ParserErrors(p.Errors())
+	}
+	return Check(program), nil
+}
+
+// Check returns the warnings for a program, in the order of the source
+func Check(program *ast.Program) []Warning {
+	c := &checker{
+		assigned:       make(map[string]bool),
+		assignedLater:  make(map[string]bool),
+		reportedReads:  make(map[string]bool),
+		parameterSalts: make(map[string]saltUse),
+	}
+	ast.Inspect(program, func(node interface{}) bool {
+		if s, ok := node.(*ast.AssignmentStatement); ok {
+			c.assignedLater[s.Var] = true
+		}
+		return true
+	})
+
+	c.statements(program.Seq)
+
+	sort.SliceStable(c.warnings, func(i, j int) bool {
+		return c.warnings[i].Start.Offset < c.warnings[j].Start.Offset
+	})
+	return c.warnings
+}
+
+type saltUse struct {
+	parameter string
+	pos       token.Position
+}
+
+type checker struct {
+	warnings []Warning
+
+	assigned      map[string]bool // variables assigned by the statements checked so far
+	assignedLater map[string]bool // variables assigned anywhere in the script
+	reportedReads map[string]bool
+
+	// parameter is the variable assigned by the statement being checked, which salts its random operators
+	parameter      string
+	parameterSalts map[string]saltUse
+}
+
+func (c *checker) warn(rule string, node interface{}, format string, args ...interface{}) {
+	span, _ := node.(ast.Node)
+	w := Warning{Rule: rule, Message: fmt.Sprintf(format, args...)}
+	if span != nil {
+		w.Start, w.End = span.SourceSpan().Start, span.SourceSpan().End
+	}
+	c.warnings = append(c.warnings, w)
+}
+
+// statements checks a sequence of statements and returns whether it always returns
+func (c *checker) statements(seq []ast.Statement) bool {
+	for i, stmt := range seq {
+		if c.statement(stmt) {
+			if i < len(seq)-1 {
+				c.warn(Unreachable, seq[i+1], "unreachable code after return")
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// statement checks a statement and returns whether it always returns
+func (c *checker) statement(stmt ast.Statement) bool {
+	switch s := stmt.(type) {
+	case *ast.AssignmentStatement:
+		c.parameter = s.Var
+		c.expression(s.Value)
+		c.parameter = ""
+		c.assigned[s.Var] = true
+	case *ast.ReturnStatement:
+		c.expression(s.Value)
+		return true
+	case *ast.IfStatement:
+		returns := true
+		for _, cond := range s.Cond {
+			c.expression(cond.Condition)
+			if cond.Consequence == nil || !c.statements(cond.Consequence.Seq) {
+				returns = false
+			}
+		}
+		// without an else block, no branch may be taken
+		last := s.Cond[len(s.Cond)-1]
+		return returns && last.Condition == ast.Boolean(true)
+	case *ast.SwitchStatement:
+		for _, cs := range s.Cases {
+			c.expression(cs.Condition)
+			c.statement(cs.Result)
+		}
+	}
+	return false
+}
+
+func (c *checker) expression(exp ast.Expression) {
+	ast.Inspect(exp, func(node interface{}) bool {
+		switch n := node.(type) {
+		case *ast.Identifier:
+			c.read(n)
+		case *ast.FunctionCallNamedArgs:
+			if ast.HashesUnit(n.Op) {
+				c.randomOp(n)
+			}
+		case *ast.FunctionCallNoArgs:
+			if ast.HashesUnit(n.Op) {
+				c.warn(MissingUnit, n, "%s without a unit", n.Op)
+			}
+		case *ast.FunctionCallOneArg:
+			if ast.HashesUnit(n.Op) {
+				c.warn(MissingUnit, n, "%s without a unit", n.Op)
+			}
+		case *ast.FunctionCallManyArgs:
+			if ast.HashesUnit(n.Op) {
+				c.warn(MissingUnit, n, "%s without a unit", n.Op)
+			}
+		}
+		return true
+	})
+}
+
+// read reports the first read of a variable assigned later in the script. Inputs are never assigned,
+// and an assignment may read the input it replaces, such as x = x ?? 0.
+func (c *checker) read(id *ast.Identifier) {
+	if c.assigned[id.Var] || !c.assignedLater[id.Var] || id.Var == c.parameter || c.reportedReads[id.Var] {
+		return
+	}
+	c.reportedReads[id.Var] = true
+	c.warn(ReadBeforeAssignment, id, "%s is read before it is assigned", id.Var)
+}
+
+func (c *checker) randomOp(call *ast.FunctionCallNamedArgs) {
+	if _, ok := call.Args["unit"]; !ok {
+		c.warn(MissingUnit, call, "%s without a unit", call.Op)
+	}
+
+	if choices, ok := arrayLength(call.Args["choices"]); ok {
+		if weights, ok := arrayLength(call.Args["weights"]); ok && weights != choices {
+			c.warn(WeightsMismatch, call, "%s has %d choices but %d weights", call.Op, choices, weights)
+		}
+	}
+
+	// Random operators hash the unit with the "salt" argument, or else with the name of the parameter.
+	// A full salt, or the salt of a rollout, is not combined with the experiment salt.
+	key, salt := "", ""
+	if s, ok := call.Args["full_salt"].(ast.StringLiteral); ok {
+		key, salt = "full_salt:"+string(s), string(s)
+	} else if s, ok := call.Args["salt"].(ast.StringLiteral); ok && call.Op == "rollout" {
+		key, salt = "full_salt:"+string(s), string(s)
+	} else if s, ok := call.Args["salt"].(ast.StringLiteral); ok {
+		key, salt = "salt:"+string(s), string(s)
+	} else if _, ok := call.Args["salt"]; !ok && call.Args["full_salt"] == nil && c.parameter != "" {
+		key, salt = "salt:"+c.parameter, c.parameter
+	}
+	if key == "" || c.parameter == "" {
+		return
+	}
+
+	use, seen := c.parameterSalts[key]
+	if !seen {
+		c.parameterSalts[key] = saltUse{c.parameter, call.Start}
+		return
+	}
+	if use.parameter != c.parameter {
+		c.warn(SaltReuse, call, "%s uses the salt %q of the parameter %s at %s", c.parameter, salt, use.parameter, use.pos)
+	}
+}
+
+// arrayLength returns the length of an array literal
+func arrayLength(exp ast.Expression) (int, bool) {
+	switch v := exp.(type) {
+	case *ast.ArrayLiteral:
+		return len(v.Values), true
+	case *ast.JSONLiteral:
+		if arr, ok := v.Value.([]interface{}); ok {
+			return len(arr), true
+		}
+	}
+	return 0, false
+}
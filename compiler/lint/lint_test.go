@@ -0,0 +1,107 @@
+package lint
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/biased-unit/planout-golang/compiler"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			"clean script",
+			"group = uniformChoice(choices=['a', 'b'], unit=userid);\nif (group == 'a') {\n  size = 1;\n} else {\n  size = 2;\n}",
+			nil,
+		},
+		{
+			"missing unit",
+			"x = uniformChoice(choices=['a', 'b']);\ny = randomFloat(min=0, max=1, unit=userid);\nz = 1 + bernoulliTrial(p=0.5);",
+			[]string{
+				"1:5: uniformChoice without a unit (missing-unit)",
+				"3:9: bernoulliTrial without a unit (missing-unit)",
+			},
+		},
+		{
+			"salt reuse",
+			"x = uniformChoice(choices=[1, 2], unit=userid, salt='s');\n" +
+				"y = uniformChoice(choices=[1, 2], unit=userid, salt='s');\n" +
+				"z = uniformChoice(choices=[1, 2], unit=userid, salt='x');\n" +
+				"w = randomFloat(min=0, max=1, unit=userid, full_salt='f');\n" +
+				"v = rollout(unit=userid, salt='f', percentage=10);\n" +
+				"x = bernoulliTrial(p=0.5, unit=userid);",
+			[]string{
+				"2:5: y uses the salt \"s\" of the parameter x at 1:5 (salt-reuse)",
+				"5:5: v uses the salt \"f\" of the parameter w at 4:5 (salt-reuse)",
+				"6:5: x uses the salt \"x\" of the parameter z at 3:5 (salt-reuse)",
+			},
+		},
+		{
+			"read before assignment",
+			"a = b + 1;\nb = 1;\nc = c ?? 2;\nd = b + e;\ne = b;",
+			[]string{
+				"1:5: b is read before it is assigned (read-before-assignment)",
+				"4:9: e is read before it is assigned (read-before-assignment)",
+			},
+		},
+		{
+			"unreachable",
+			"if (a) {\n  return true;\n  x = 1;\n} else {\n  return false;\n}\ny = 2;\nz = 3;",
+			[]string{
+				"3:3: unreachable code after return (unreachable)",
+				"7:1: unreachable code after return (unreachable)",
+			},
+		},
+		{
+			"return in some branches",
+			"if (a) {\n  return true;\n} else if (b) {\n  x = 1;\n}\ny = 2;",
+			nil,
+		},
+		{
+			"weights mismatch",
+			"x = weightedChoice(choices=['a', 'b', 'c'], weights=[1, 2], unit=userid);\n" +
+				"y = weightedChoice(choices=[1, 2], weights=w, unit=userid);",
+			[]string{
+				"1:5: weightedChoice has 3 choices but 2 weights (weights-mismatch)",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			warnings, err := Source([]byte(tc.input))
+			require.NoError(t, err)
+
+			var actual []string
+			for _, w := range warnings {
+				actual = append(actual, w.String())
+			}
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestSource_Fixtures(t *testing.T) {
+	files, err := filepath.Glob("../testdata/*.planout")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			src, err := ioutil.ReadFile(file)
+			require.NoError(t, err)
+			_, err = Source(src)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSource_Errors(t *testing.T) {
+	_, err := Source([]byte("x = ;"))
+	require.IsType(t, compiler.ParserErrors{}, err)
+}
@@ -0,0 +1,355 @@
+// Package optimize simplifies the syntax tree of a PlanOut script before it is compiled, so that the interpreter
+// does not evaluate the same constants on every run. Constant arithmetic, logic and comparisons are folded,
+// if statements lose their branches that can never be taken, and the statements of a branch that is always
+// taken replace the if statement.
+//
+// The optimized code evaluates to the same values as the original code: an operation is only folded when its
+// result is the one the interpreter computes, and operations that fail at runtime are kept. The arguments of the
+// random operators are left as they are, so that the assignments of the experiments do not change.
+package optimize
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/biased-unit/planout-golang/compiler/ast"
+)
+
+// Program optimizes a program in place
+func Program(program *ast.Program) {
+	program.Seq = statements(program.Seq)
+}
+
+// statements optimizes a sequence of statements, replacing the if statements with a branch always taken
+// by the statements of the branch
+func statements(seq []ast.Statement) []ast.Statement {
+	result := make([]ast.Statement, 0, len(seq))
+	for _, stmt := range seq {
+		switch s := stmt.(type) {
+		case *ast.AssignmentStatement:
+			s.Value = expression(s.Value)
+			result = append(result, s)
+		case *ast.ReturnStatement:
+			s.Value = expression(s.Value)
+			result = append(result, s)
+		case *ast.IfStatement:
+			result = append(result, ifStatement(s)...)
+		case *ast.SwitchStatement:
+			// The cases are kept: the interpreter has no switch operator to compare them with.
+			for i := range s.Cases {
+				s.Cases[i].Condition = expression(s.Cases[i].Condition)
+				if result := statements([]ast.Statement{s.Cases[i].Result}); len(result) == 1 {
+					s.Cases[i].Result = result[0]
+				}
+			}
+			result = append(result, s)
+		default:
+			result = append(result, stmt)
+		}
+	}
+	return result
+}
+
+// ifStatement returns the statements replacing an if statement
+func ifStatement(s *ast.IfStatement) []ast.Statement {
+	cond := make([]ast.Conditional, 0, len(s.Cond))
+	for _, c := range s.Cond {
+		c.Condition = expression(c.Condition)
+		if c.Consequence != nil {
+			c.Consequence.Seq = statements(c.Consequence.Seq)
+		}
+
+		taken, ok := truth(c.Condition)
+		if !ok {
+			cond = append(cond, c)
+			continue
+		}
+		if !taken {
+			continue
+		}
+		// the branches following a branch always taken are never taken
+		if len(cond) == 0 {
+			if c.Consequence == nil {
+				return nil
+			}
+			return c.Consequence.Seq
+		}
+		cond = append(cond, c)
+		break
+	}
+
+	if len(cond) == 0 {
+		return nil
+	}
+	s.Cond = cond
+	return []ast.Statement{s}
+}
+
+// expression returns the optimized expression
+func expression(exp ast.Expression) ast.Expression {
+	switch e := exp.(type) {
+	case *ast.ArrayLiteral:
+		for i, v := range e.Values {
+			e.Values[i] = expression(v)
+		}
+	case *ast.IndexExpression:
+		e.Base = expression(e.Base)
+		e.Index = expression(e.Index)
+	case *ast.PrefixExpression:
+		e.Value = expression(e.Value)
+		return prefix(e)
+	case *ast.InfixExpressionLeftRight:
+		e.Left = expression(e.Left)
+		e.Right = expression(e.Right)
+		return infixLeftRight(e)
+	case *ast.InfixExpressionValues:
+		e.Values[0] = expression(e.Values[0])
+		e.Values[1] = expression(e.Values[1])
+		return infixValues(e)
+	case *ast.FunctionCallOneArg:
+		if !ast.IsRandomOp(e.Op) {
+			e.Value = expression(e.Value)
+		}
+	case *ast.FunctionCallManyArgs:
+		if !ast.IsRandomOp(e.Op) {
+			for i, v := range e.Values {
+				e.Values[i] = expression(v)
+			}
+		}
+	case *ast.FunctionCallNamedArgs:
+		if !ast.IsRandomOp(e.Op) {
+			for name, v := range e.Args {
+				e.Args[name] = expression(v)
+			}
+		}
+	}
+	return exp
+}
+
+func prefix(e *ast.PrefixExpression) ast.Expression {
+	switch e.Op {
+	case "not":
+		if t, ok := truth(e.Value); ok {
+			return ast.Boolean(!t)
+		}
+	case "negative":
+		switch v := e.Value.(type) {
+		case ast.IntegerLiteral:
+			return -v
+		case ast.FloatLiteral:
+			return -v
+		}
+	}
+	return e
+}
+
+func infixLeftRight(e *ast.InfixExpressionLeftRight) ast.Expression {
+	left, lok := constant(e.Left)
+	right, rok := constant(e.Right)
+	if !lok || !rok {
+		return e
+	}
+
+	switch e.Op {
+	case "equals":
+		if left == nil || right == nil {
+			return ast.Boolean(left == nil && right == nil)
+		}
+		if cmp, ok := compare(left, right); ok {
+			return ast.Boolean(cmp == 0)
+		}
+	case "<", "<=", ">", ">=":
+		// null is neither less than nor greater than any value
+		if left == nil || right == nil {
+			return ast.Boolean(false)
+		}
+		if cmp, ok := compare(left, right); ok {
+			switch e.Op {
+			case "<":
+				return ast.Boolean(cmp < 0)
+			case "<=":
+				return ast.Boolean(cmp <= 0)
+			case ">":
+				return ast.Boolean(cmp > 0)
+			default:
+				return ast.Boolean(cmp >= 0)
+			}
+		}
+	case "%":
+		if l, ok := left.(int64); ok {
+			if r, ok := right.(int64); ok && r != 0 {
+				ret := l % r
+				if ret != 0 && (ret < 0) != (r < 0) {
+					ret += r
+				}
+				return ast.IntegerLiteral(ret)
+			}
+		}
+		l, lok := number(left)
+		r, rok := number(right)
+		if lok && rok && r != 0 {
+			ret := math.Mod(l, r)
+			if ret != 0 && (ret < 0) != (r < 0) {
+				ret += r
+			}
+			return float(ret, e)
+		}
+	case "/":
+		l, lok := number(left)
+		r, rok := number(right)
+		if lok && rok && r != 0 {
+			return float(l/r, e)
+		}
+	}
+	return e
+}
+
+func infixValues(e *ast.InfixExpressionValues) ast.Expression {
+	left, lok := constant(e.Values[0])
+	right, rok := constant(e.Values[1])
+
+	switch e.Op {
+	case "and", "or":
+		// the values are evaluated in order until one decides the result
+		if t, ok := truth(e.Values[0]); ok {
+			if t == (e.Op == "or") {
+				return ast.Boolean(t)
+			}
+			if t, ok := truth(e.Values[1]); ok {
+				return ast.Boolean(t)
+			}
+		}
+	case "coalesce":
+		if lok && left == nil {
+			return e.Values[1]
+		}
+		if lok {
+			return e.Values[0]
+		}
+	case "sum", "product":
+		if !lok || !rok {
+			return e
+		}
+		if l, ok := left.(int64); ok {
+			if r, ok := right.(int64); ok {
+				if e.Op == "sum" {
+					return ast.IntegerLiteral(l + r)
+				}
+				return ast.IntegerLiteral(l * r)
+			}
+		}
+		l, lok := number(left)
+		r, rok := number(right)
+		if lok && rok {
+			if e.Op == "sum" {
+				return float(l+r, e)
+			}
+			return float(l*r, e)
+		}
+	}
+	return e
+}
+
+// float returns the literal of a float result, or the original expression when the literal would compile
+// to an integer instead
+func float(f float64, original ast.Expression) ast.Expression {
+	if f == math.Trunc(f) || math.IsInf(f, 0) || math.IsNaN(f) {
+		return original
+	}
+	return ast.FloatLiteral(f)
+}
+
+// constant returns the value of a literal number, string, boolean or null
+func constant(exp ast.Expression) (interface{}, bool) {
+	switch e := exp.(type) {
+	case ast.IntegerLiteral:
+		return int64(e), true
+	case ast.FloatLiteral:
+		return float64(e), true
+	case ast.StringLiteral:
+		return string(e), true
+	case ast.Boolean:
+		return bool(e), true
+	case *ast.NullLiteral:
+		return nil, true
+	}
+	return nil, false
+}
+
+// number returns a literal number. Unlike the interpreter, strings and booleans are not converted to numbers:
+// the operations on them are not folded.
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// truth returns whether the interpreter takes a constant expression as true
+func truth(exp ast.Expression) (bool, bool) {
+	v, ok := constant(exp)
+	if !ok {
+		return false, false
+	}
+	switch v := v.(type) {
+	case nil:
+		return false, true
+	case bool:
+		return v, true
+	case string:
+		return v != "", true
+	}
+	n, _ := number(v)
+	return compareFloat(n, 0) != 0, true
+}
+
+// compare orders two constants like the interpreter: strings with strings, and numbers, booleans and numeric
+// strings with each other
+func compare(lhs, rhs interface{}) (int, bool) {
+	l, lok := lhs.(string)
+	r, rok := rhs.(string)
+	if lok && rok {
+		switch {
+		case l < r:
+			return -1, true
+		case l > r:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	ln, lok := toNumber(lhs)
+	rn, rok := toNumber(rhs)
+	if lok && rok {
+		return compareFloat(ln, rn), true
+	}
+	return 0, false
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return number(v)
+}
+
+// compareFloat compares numbers within the tolerance of the interpreter
+func compareFloat(lhs, rhs float64) int {
+	switch {
+	case math.Abs(lhs-rhs) < 0.0001:
+		return 0
+	case lhs < rhs:
+		return -1
+	}
+	return 1
+}
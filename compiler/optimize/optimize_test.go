@@ -0,0 +1,82 @@
+package optimize
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/biased-unit/planout-golang/compiler/ast"
+	"github.com/biased-unit/planout-golang/compiler/decompiler"
+	"github.com/biased-unit/planout-golang/compiler/lexer"
+	"github.com/biased-unit/planout-golang/compiler/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgram(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"arithmetic",
+			"a = 1 / 100;\nb = 2 + 3 * 4;\nc = 7 % -3;\nd = 7.5 % 2;\ne = -(2 - 5);\nf = 0.1 + 0.2;",
+			"a = 0.01;\nb = 14;\nc = -2;\nd = 1.5;\ne = 3;\nf = 0.30000000000000004;\n",
+		},
+		{
+			"results compiling to a different type are kept",
+			"a = 10 / 2;\nb = 0.5 + 0.5;\nc = 1 / 0;\nd = 1 % 0;\ne = 'a' + 'b';\nf = true + 1;",
+			"a = 10 / 2;\nb = 0.5 + 0.5;\nc = 1 / 0;\nd = 1 % 0;\ne = \"a\" + \"b\";\nf = true + 1;\n",
+		},
+		{
+			"comparisons",
+			"a = 1 < 2;\nb = 'b' <= 'a';\nc = 1 == 1.00001;\nd = '2' == 2;\ne = null == null;\nf = null < 1;\ng = 1 != 2;\nh = 'a' == 1;",
+			"a = true;\nb = false;\nc = true;\nd = true;\ne = true;\nf = false;\ng = true;\nh = \"a\" == 1;\n",
+		},
+		{
+			"logic",
+			"a = true && x;\nb = false && x;\nc = 1 || x;\nd = '' || 0;\ne = !0.00001;\nf = null ?? x;\ng = 2 ?? x;\nh = x ?? 2;",
+			"a = true && x;\nb = false;\nc = true;\nd = false;\ne = true;\nf = x;\ng = 2;\nh = x ?? 2;\n",
+		},
+		{
+			"nested expressions",
+			"a = [1 + 1, x * (2 * 3)];\nb = f(v=100 / 8)[2 - 1];\nc = max(1 + 1, x);",
+			"a = [2, x * 6];\nb = f(v=12.5)[1];\nc = max(2, x);\n",
+		},
+		{
+			"random operators are left as they are",
+			"a = uniformChoice(choices=[1 + 1, 2 * 2], unit=userid);\nb = randomFloat(min=0, max=1 / 4, unit=userid) * (2 * 2);",
+			"a = uniformChoice(choices=[1 + 1, 2 * 2], unit=userid);\nb = randomFloat(min=0, max=1 / 4, unit=userid) * 4;\n",
+		},
+		{
+			"branches",
+			"if (1 > 2) {\n  a = 1;\n} else if (x) {\n  a = 2;\n} else if (true) {\n  a = 3;\n} else {\n  a = 4;\n}",
+			"if (x) {\n  a = 2;\n} else {\n  a = 3;\n}\n",
+		},
+		{
+			"branches always taken are flattened",
+			"a = 1;\nif (false) {\n  a = 2;\n} else if (2 > 1) {\n  if (true) {\n    b = 3;\n    return true;\n  }\n}\nc = 4;",
+			"a = 1;\nb = 3;\nreturn true;\nc = 4;\n",
+		},
+		{
+			"branches never taken are removed",
+			"a = 1;\nif (false) {\n  a = 2;\n} else if (null) {\n  a = 3;\n}",
+			"a = 1;\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tc.input))
+			program := p.ParseProgram()
+			require.Empty(t, p.Errors())
+
+			Program(program)
+
+			ast.KeepSourceOrder(program)
+			code, err := json.Marshal(program)
+			require.NoError(t, err)
+			actual, err := decompiler.Decompile(code)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
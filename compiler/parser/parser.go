@@ -5,9 +5,13 @@ package parser
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/biased-unit/planout-golang/compiler/ast"
+	"github.com/biased-unit/planout-golang/compiler/lexer"
 	"github.com/biased-unit/planout-golang/compiler/token"
 )
 
@@ -96,12 +100,30 @@ type Parser struct {
 	infixParseFns  map[token.Type]infixParseFn
 
 	errors []error
+	// panicking is set from the first error of a statement until synchronize
+	// skips past the statement, so that the errors it causes are not reported
+	panicking bool
+	// strict rejects the syntax that the official compiler does not accept
+	strict bool
 }
 
 type tokenLexer interface {
 	NextToken() token.Token
 }
 
+// extensionLexer is implemented by lexers that record the syntax the official compiler does not accept
+type extensionLexer interface {
+	Extensions() []lexer.Extension
+}
+
+// SetStrict makes the parser only accept the scripts that the official compiler accepts, and parse JSON
+// literals like it does. The comments, escape sequences in strings and dots in identifiers that the
+// lexer records are reported as errors, along with a "+" or "-" operator directly followed by a
+// number, and a case of a switch statement that assigns a variable.
+func (p *Parser) SetStrict(strict bool) {
+	p.strict = strict
+}
+
 type (
 	prefixParseFn func() ast.Expression
 	infixParseFn  func(ast.Expression) ast.Expression
@@ -110,7 +132,18 @@ type (
 type LexingError token.Token
 
 func (le LexingError) Error() string {
-	return fmt.Sprintf("%d: %s", le.Line, le.Val)
+	return fmt.Sprintf("%s: %s", token.Token(le).Pos(), le.Val)
+}
+
+// Span returns the positions of the first character and just past the last character
+// of the text that could not be lexed
+func (le LexingError) Span() (token.Position, token.Position) {
+	return token.Token(le).Pos(), le.End
+}
+
+// Message returns the error without its position
+func (le LexingError) Message() string {
+	return le.Val
 }
 
 type ParsingError struct {
@@ -119,16 +152,36 @@ type ParsingError struct {
 }
 
 func (pe ParsingError) Error() string {
-	return fmt.Sprintf("%d: %s", pe.Tok.Line, pe.Err.Error())
+	return fmt.Sprintf("%s: %s", pe.Tok.Pos(), pe.Err.Error())
+}
+
+// Span returns the positions of the first character and just past the last character
+// of the token the error was found at
+func (pe ParsingError) Span() (token.Position, token.Position) {
+	return pe.Tok.Pos(), pe.Tok.End
+}
+
+// Message returns the error without its position
+func (pe ParsingError) Message() string {
+	return pe.Err.Error()
+}
+
+func (pe ParsingError) Unwrap() error {
+	return pe.Err
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
 	program := ast.NewProgram()
+	start := token.Position{Line: 1, Column: 1}
 
 	for !p.curTokenIs(token.EOF) {
 		exp := p.parseStatement()
-		if exp == nil || len(p.errors) > 0 {
-			return program
+		if exp == nil || p.panicking {
+			p.synchronize()
+			if p.curTokenIs(token.RBRACE) {
+				p.nextToken() // a stray closing brace
+			}
+			continue
 		}
 		program.Seq = append(program.Seq, exp)
 		p.nextToken()
@@ -137,12 +190,96 @@ func (p *Parser) ParseProgram() *ast.Program {
 		}
 	}
 
+	program.SetSpan(start, p.curToken.End)
+
+	if p.strict {
+		p.reportExtensions()
+	}
 	return program
 }
 
+// reportExtensions records an error for each extension of the official syntax found by the lexer,
+// then sorts the errors by position
+func (p *Parser) reportExtensions() {
+	lx, ok := p.lx.(extensionLexer)
+	if !ok {
+		return
+	}
+	for _, ext := range lx.Extensions() {
+		tok := token.Token{Type: token.ERROR, Line: ext.Start.Line, Column: ext.Start.Column, Offset: ext.Start.Offset, End: ext.End}
+		p.errors = append(p.errors, ParsingError{
+			Tok: tok,
+			Err: fmt.Errorf("%s are not supported by the official compiler", ext.Feature),
+		})
+	}
+	sort.SliceStable(p.errors, func(i, j int) bool {
+		return errorOffset(p.errors[i]) < errorOffset(p.errors[j])
+	})
+}
+
+func errorOffset(err error) int {
+	switch err := err.(type) {
+	case LexingError:
+		return err.Offset
+	case ParsingError:
+		return err.Tok.Offset
+	}
+	return 0
+}
+
+// strictError records an error in strict mode without aborting the statement, which is otherwise valid
+func (p *Parser) strictError(tok token.Token, format string, args ...interface{}) {
+	if !p.panicking {
+		p.errors = append(p.errors, ParsingError{Tok: tok, Err: fmt.Errorf(format, args...)})
+	}
+}
+
+// nextToken advances to the next token. Lexing errors are recorded as soon as they are read,
+// and abort the statement being parsed like a syntax error.
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.lx.NextToken()
+	if p.peekTokenIs(token.ERROR) {
+		p.errors = append(p.errors, LexingError(p.peekToken))
+		p.panicking = true
+	}
+}
+
+// synchronize implements panic-mode recovery after a statement fails to parse.
+// It skips tokens up to the ";" ending the statement, or up to the "}" closing the
+// enclosing block, so that parsing can resume at the next statement. Blocks nested
+// in the statement are skipped as a whole, along with their else blocks.
+// If the lexer stops making progress, returning a token with the same span as the previous
+// one, it reports an error and stops parsing there rather than skipping tokens forever.
+func (p *Parser) synchronize() {
+	defer func() { p.panicking = false }()
+	depth := 0
+	for !p.curTokenIs(token.EOF) {
+		if !p.peekTokenIs(token.EOF) && p.peekToken.Offset == p.curToken.Offset && p.peekToken.End == p.curToken.End {
+			p.errors = append(p.errors, ParsingError{Tok: p.peekToken, Err: fmt.Errorf("no progress lexing %q", p.peekToken.Val)})
+			p.curToken = token.Token{Type: token.EOF, Line: p.peekToken.Line, Column: p.peekToken.Column, Offset: p.peekToken.Offset, End: p.peekToken.End}
+			return
+		}
+		switch p.curToken.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				return
+			}
+			depth--
+			if depth == 0 && !p.peekTokenIs(token.ELSE) {
+				p.nextToken()
+				return
+			}
+		case token.SEMICOLON:
+			if depth == 0 {
+				p.nextToken()
+				return
+			}
+		}
+		p.nextToken()
+	}
 }
 
 func (p *Parser) registerPrefix(itemType token.Type, fn prefixParseFn) {
@@ -171,6 +308,7 @@ func (p *Parser) parseStatement() ast.Statement {
 
 func (p *Parser) parseSwitchStatement() *ast.SwitchStatement {
 	var cases []ast.Case
+	start := p.curToken.Pos()
 
 	if !p.accept(token.LBRACE) {
 		p.tokTypeError(p.curToken, token.LBRACE)
@@ -179,16 +317,30 @@ func (p *Parser) parseSwitchStatement() *ast.SwitchStatement {
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		caseStart := p.curToken.Pos()
 		cond := p.parseSimpleExpression(LOWEST)
 
-		if !p.accept(token.THEN) {
+		if !p.panicking && !p.accept(token.THEN) {
 			p.tokTypeError(p.peekToken, token.THEN)
-			return nil
+		}
+		if p.panicking {
+			// skip the case up to its ";", or to the "}" closing the switch, and parse the next cases
+			p.synchronize()
+			continue
 		}
 		p.nextToken()
 
+		if p.strict && p.curTokenIs(token.IDENT) {
+			p.strictError(p.curToken, "assignments in switch cases are not supported by the official compiler")
+		}
 		res := p.parseStatement()
-		cases = append(cases, ast.Case{Condition: cond, Result: res})
+		if res == nil || p.panicking {
+			p.synchronize()
+			continue
+		}
+		cs := ast.Case{Condition: cond, Result: res}
+		cs.SetSpan(caseStart, p.curToken.End)
+		cases = append(cases, cs)
 
 		p.nextToken()
 
@@ -197,15 +349,19 @@ func (p *Parser) parseSwitchStatement() *ast.SwitchStatement {
 		}
 	}
 
-	return ast.NewSwitchStatement(cases...)
+	stmt := ast.NewSwitchStatement(cases...)
+	stmt.SetSpan(start, p.curToken.End)
+	return stmt
 }
 
 // parseIfStatement iteratively parses a chain of if/else statements
 func (p *Parser) parseIfStatement() *ast.IfStatement {
 
 	var conds []ast.Conditional
+	start := p.curToken.Pos()
 
 	for !p.curTokenIs(token.EOF) {
+		condStart := p.curToken.Pos()
 
 		// loop should always start on the IF token so next token must be open paren
 		if !p.accept(token.LPAREN) {
@@ -227,7 +383,9 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 			return nil
 		}
 		cons := p.parseBlockStatement()
-		conds = append(conds, ast.Conditional{Condition: cond, Consequence: cons})
+		conditional := ast.Conditional{Condition: cond, Consequence: cons}
+		conditional.SetSpan(condStart, p.curToken.End)
+		conds = append(conds, conditional)
 
 		// If there's no else block, we are done
 		if !p.accept(token.ELSE) {
@@ -242,19 +400,28 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 		case token.IF:
 			p.nextToken()
 		case token.LBRACE:
+			elseStart := p.curToken.Pos()
 			p.nextToken()
 			alt := p.parseBlockStatement()
-			conds = append(conds, ast.Conditional{Condition: ast.Boolean(true), Consequence: alt})
-			return ast.NewIfStatement(conds...)
+			conditional := ast.Conditional{Condition: ast.Boolean(true), Consequence: alt}
+			conditional.SetSpan(elseStart, p.curToken.End)
+			conds = append(conds, conditional)
+
+			stmt := ast.NewIfStatement(conds...)
+			stmt.SetSpan(start, p.curToken.End)
+			return stmt
 		}
 	}
 
-	return ast.NewIfStatement(conds...)
+	stmt := ast.NewIfStatement(conds...)
+	stmt.SetSpan(start, p.curToken.End)
+	return stmt
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	start := p.curToken.Pos()
 	if p.accept(token.EOF) {
-		p.errors = append(p.errors, ParsingError{
+		p.parseError(ParsingError{
 			Tok: p.curToken,
 			Err: fmt.Errorf("EOF while parsing block statement"),
 		})
@@ -266,16 +433,18 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	var seq []ast.Statement
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		exp := p.parseStatement()
-		if exp != nil {
-			seq = append(seq, exp)
+		if exp == nil || p.panicking {
+			p.synchronize()
+			continue
 		}
+		seq = append(seq, exp)
 		switch {
 		default:
 			p.tokTypeError(p.curToken, token.SEMICOLON, token.RBRACE)
-			return nil
+			p.synchronize()
 		case p.curTokenIs(token.SEMICOLON):
 			if p.accept(token.EOF) {
-				p.errors = append(p.errors, ParsingError{
+				p.parseError(ParsingError{
 					Tok: p.curToken,
 					Err: fmt.Errorf("EOF while parsing block statement"),
 				})
@@ -286,12 +455,15 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 			p.nextToken()
 		}
 	}
-	return ast.NewBlockStatement(seq...)
+	block := ast.NewBlockStatement(seq...)
+	block.SetSpan(start, p.curToken.End)
+	return block
 }
 
 func (p *Parser) parseAssignmentStatement() *ast.AssignmentStatement {
 
 	varName := p.curToken.Val
+	start := p.curToken.Pos()
 
 	if !p.accept(token.ASSIGN, token.ARROW) {
 		p.tokTypeError(p.peekToken, token.ASSIGN, token.ARROW)
@@ -302,23 +474,35 @@ func (p *Parser) parseAssignmentStatement() *ast.AssignmentStatement {
 
 	// Now parse the expression to the right of the assignment operator
 	value := p.parseSimpleExpression(LOWEST)
+	end := p.statementEnd()
 
-	if !p.curTokenIs(token.SEMICOLON) {
-		p.nextToken()
-	}
-
-	return ast.NewAssignmentStatement(varName, value)
+	stmt := ast.NewAssignmentStatement(varName, value)
+	stmt.SetSpan(start, end)
+	return stmt
 }
 
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+	start := p.curToken.Pos()
 	p.nextToken()
 	value := p.parseSimpleExpression(LOWEST)
+	end := p.statementEnd()
+
+	stmt := ast.NewReturnStatement(value)
+	stmt.SetSpan(start, end)
+	return stmt
+}
 
+// statementEnd moves past the last token of a simple statement, to its semicolon if there is one,
+// and returns the position at which the statement ends
+func (p *Parser) statementEnd() token.Position {
+	end := p.curToken.End
 	if !p.curTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
-
-	return ast.NewReturnStatement(value)
+	if p.curTokenIs(token.SEMICOLON) {
+		end = p.curToken.End
+	}
+	return end
 }
 
 // parseSimpleExpression implements Pratt parsing to correctly
@@ -326,8 +510,7 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 func (p *Parser) parseSimpleExpression(precedence int) ast.Expression {
 
 	if p.curTokenIs(token.ERROR) {
-		p.errors = append(p.errors, LexingError(p.curToken))
-		return nil
+		return nil // already recorded by nextToken
 	}
 
 	prefix := p.prefixParseFns[p.curToken.Type]
@@ -335,7 +518,9 @@ func (p *Parser) parseSimpleExpression(precedence int) ast.Expression {
 		p.noPrefixParseFnError(p.curToken.Type)
 		return nil
 	}
+	start := p.curToken.Pos()
 	leftExp := prefix()
+	p.setSpan(leftExp, start)
 
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
@@ -345,11 +530,27 @@ func (p *Parser) parseSimpleExpression(precedence int) ast.Expression {
 
 		p.nextToken()
 		leftExp = infix(leftExp)
+		p.setSpan(leftExp, start)
 	}
 
 	return leftExp
 }
 
+// setSpan records that an expression spans the script from start to the current token.
+// A "not" built for the != operator passes its span to the "equals" it wraps.
+func (p *Parser) setSpan(exp ast.Expression, start token.Position) {
+	node, ok := exp.(ast.Node)
+	if !ok {
+		return
+	}
+	node.SetSpan(start, p.curToken.End)
+	if prefix, ok := exp.(*ast.PrefixExpression); ok {
+		if inner, ok := prefix.Value.(ast.Node); ok && inner.SourceSpan() == (ast.Span{}) {
+			inner.SetSpan(start, p.curToken.End)
+		}
+	}
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	tokType := p.curToken.Type
 	tokPrecedence := p.curPrecedence()
@@ -378,10 +579,24 @@ func (p *Parser) parsePrefixSub() ast.Expression {
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	tokType := p.curToken.Type
 	precedence := p.curPrecedence()
+	if p.strict && (tokType == token.ADD || tokType == token.SUB) && p.peekTokenIs(token.NUMBER) &&
+		p.peekToken.Offset == p.curToken.End.Offset {
+		// the official lexer reads a sign directly followed by a number as part of the number
+		p.strictError(p.curToken, "the official compiler requires a space after %q", p.curToken.Val)
+	}
 	p.nextToken()
+	rightStart := p.curToken.Pos()
 	right := p.parseSimpleExpression(precedence)
 
-	return ast.NewInfixExpression(tokType, left, right)
+	exp := ast.NewInfixExpression(tokType, left, right)
+
+	// a - b compiles to a + (-b): the negation spans b
+	if sum, ok := exp.(*ast.InfixExpressionValues); ok && tokType == token.SUB {
+		if neg, ok := sum.Values[1].(ast.Node); ok {
+			neg.SetSpan(rightStart, p.curToken.End)
+		}
+	}
+	return exp
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
@@ -436,7 +651,7 @@ func (p *Parser) parseNumericLiteral() ast.Expression {
 		return fVal
 	}
 
-	p.errors = append(p.errors, ParsingError{
+	p.parseError(ParsingError{
 		Tok: p.curToken,
 		Err: fmt.Errorf("not a valid number: %s", p.curToken.Val),
 	})
@@ -479,18 +694,63 @@ func (p *Parser) parseNull() ast.Expression {
 
 func (p *Parser) parseJSONLiteral() ast.Expression {
 	var val interface{}
-	err := json.Unmarshal([]byte(p.curToken.Val), &val)
+	var err error
+	if p.strict {
+		val, err = decodeOrderedJSON(json.NewDecoder(strings.NewReader(p.curToken.Val)))
+	} else {
+		err = json.Unmarshal([]byte(p.curToken.Val), &val)
+	}
 	if err != nil {
 		parseError := ParsingError{
 			Tok: p.curToken,
 			Err: fmt.Errorf("failed to parse JSON literal %s: %w", p.curToken.Val, err),
 		}
-		p.errors = append(p.errors, parseError)
+		p.parseError(parseError)
 		return nil
 	}
 	return ast.NewJSONLiteral(val)
 }
 
+// decodeOrderedJSON decodes the next JSON value like JavaScript's JSON.parse does for the official compiler:
+// the keys of objects that are array indices come first in increasing order, then the other keys in the
+// order of the source. A repeated key keeps its first place and its last value.
+func decodeOrderedJSON(dec *json.Decoder) (interface{}, error) {
+	val, err := ast.DecodeJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	sortJSKeys(val)
+	return val, nil
+}
+
+// sortJSKeys moves the keys that are array indices first in the objects of a decoded value
+func sortJSKeys(val interface{}) {
+	switch val := val.(type) {
+	case *ast.JSONObject:
+		sort.SliceStable(val.Keys, func(i, j int) bool {
+			a, aIndex := arrayIndex(val.Keys[i])
+			b, bIndex := arrayIndex(val.Keys[j])
+			return aIndex && (!bIndex || a < b)
+		})
+		for _, v := range val.Values {
+			sortJSKeys(v)
+		}
+	case []interface{}:
+		for _, v := range val {
+			sortJSKeys(v)
+		}
+	}
+}
+
+// arrayIndex returns the index named by a key that JavaScript treats as an array index
+func arrayIndex(key string) (uint64, bool) {
+	i, err := strconv.ParseUint(key, 10, 32)
+	if err != nil || i == math.MaxUint32 || strconv.FormatUint(i, 10) != key {
+		return 0, false
+	}
+	return i, true
+}
+
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	p.nextToken()
 	ind := p.parseSimpleExpression(LOWEST)
@@ -508,49 +768,54 @@ func (p *Parser) parseCallExpression(left ast.Expression) ast.Expression {
 			Tok: p.curToken,
 			Err: fmt.Errorf("%s ( %s", left, "function-call syntax with non-identifier expression"),
 		}
-		p.errors = append(p.errors, parseError)
+		p.parseError(parseError)
 		return nil
 	}
 
-	if p.peekTokenIs(token.RPAREN) {
+	if p.accept(token.RPAREN) {
 		return ast.NewFunctionCall(funcIdentifier.Var)
 	}
 	p.nextToken()
 
 	if p.peekTokenIs(token.ASSIGN) {
-		args := p.parseNamedArgsList()
-		return ast.NewFunctionCallNamedArgs(funcIdentifier.Var, args)
+		args, names := p.parseNamedArgsList()
+		return ast.NewFunctionCallNamedArgs(funcIdentifier.Var, args, names...)
 	}
 
 	args := p.parseSimpleExpressionList(token.RPAREN)
 	return ast.NewFunctionCall(funcIdentifier.Var, args...)
 }
 
-func (p *Parser) parseNamedArgsList() ast.NamedArgs {
+// parseNamedArgsList returns the arguments by name, and their names in the order of the source
+func (p *Parser) parseNamedArgsList() (ast.NamedArgs, []string) {
 	args := make(map[string]ast.Expression)
+	var names []string
 	for !p.curTokenIs(token.RPAREN) && !p.curTokenIs(token.EOF) {
 		if p.curToken.Type != token.IDENT {
 			p.tokTypeError(p.curToken, token.IDENT)
-			return nil
+			return nil, nil
 		}
 		varName := p.curToken.Val
 		if !p.accept(token.ASSIGN) {
 			p.tokTypeError(p.peekToken, token.ASSIGN)
-			return nil
+			return nil, nil
 		}
 		p.nextToken()
 		value := p.parseSimpleExpression(LOWEST)
+		if _, seen := args[varName]; !seen {
+			names = append(names, varName)
+		}
 		args[varName] = value
 		p.nextToken()
 		if p.curTokenIs(token.COMMA) {
 			p.nextToken()
 		}
 	}
-	return args
+	return args, names
 }
 
 func (p *Parser) noPrefixParseFnError(t token.Type) {
-	p.errors = append(p.errors, ParsingError{
+	p.parseError(ParsingError{
 		Tok: p.curToken,
 		Err: fmt.Errorf("no prefix parse function for token type %s", t),
 	})
@@ -593,6 +858,14 @@ func (p *Parser) accept(allowed ...token.Type) bool {
 	return false
 }
 
+// parseError records a syntax error, unless it follows another error in the same statement
+func (p *Parser) parseError(err ParsingError) {
+	if !p.panicking {
+		p.errors = append(p.errors, err)
+	}
+	p.panicking = true
+}
+
 func (p *Parser) Errors() []error {
 	return p.errors
 }
@@ -604,7 +877,7 @@ func (p *Parser) HadError() bool {
 func (p *Parser) tokTypeError(got token.Token, expected ...token.Type) {
 	switch got.Type {
 	case token.ERROR:
-		p.errors = append(p.errors, LexingError(got))
+		// already recorded by nextToken
 	default:
 		err := ParsingError{
 			Tok: got,
@@ -613,6 +886,6 @@ func (p *Parser) tokTypeError(got token.Token, expected ...token.Type) {
 		if len(expected) == 1 {
 			err.Err = fmt.Errorf("expecting %q, got %q", expected[0], got)
 		}
-		p.errors = append(p.errors, err)
+		p.parseError(err)
 	}
 }
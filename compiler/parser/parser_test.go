@@ -5,6 +5,7 @@ import (
 
 	"github.com/biased-unit/planout-golang/compiler/ast"
 	"github.com/biased-unit/planout-golang/compiler/lexer"
+	"github.com/biased-unit/planout-golang/compiler/token"
 )
 
 func TestAssignmentStatement(t *testing.T) {
@@ -190,3 +191,84 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+// stuckLexer returns its tokens, then repeats the last one forever
+type stuckLexer []token.Token
+
+func (lx *stuckLexer) NextToken() token.Token {
+	tok := (*lx)[0]
+	if len(*lx) > 1 {
+		*lx = (*lx)[1:]
+	}
+	return tok
+}
+
+func TestSynchronizeStopsWithoutProgress(t *testing.T) {
+	at := func(offset int) token.Position { return token.Position{Offset: offset, Line: 1, Column: offset + 1} }
+	lx := &stuckLexer{
+		{Type: token.IDENT, Val: "x", Line: 1, Column: 1, Offset: 0, End: at(1)},
+		{Type: token.ASSIGN, Val: "=", Line: 1, Column: 3, Offset: 2, End: at(3)},
+		{Type: token.IDENT, Val: "", Line: 1, Column: 5, Offset: 4, End: at(4)},
+	}
+	p := New(lx)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatal("expected errors, got none")
+	}
+	if last := errors[len(errors)-1].Error(); last != `1:5: no progress lexing ""` {
+		t.Errorf("last error wrong. expected=%q, got=%q", `1:5: no progress lexing ""`, last)
+	}
+}
+
+func TestSpans(t *testing.T) {
+	input := "x = uniformChoice(choices=[1, 2], unit=userid);\nif (x != 1) {\n  y = x - 2;\n} else {\n  return f();\n}\n"
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	text := func(n ast.Node) string {
+		span := n.SourceSpan()
+		return input[span.Start.Offset:span.End.Offset]
+	}
+
+	assign := program.Seq[0].(*ast.AssignmentStatement)
+	call := assign.Value.(*ast.FunctionCallNamedArgs)
+	ifStmt := program.Seq[1].(*ast.IfStatement)
+	neq := ifStmt.Cond[0].Condition.(*ast.PrefixExpression)
+	inner := ifStmt.Cond[0].Consequence.Seq[0].(*ast.AssignmentStatement)
+	diff := inner.Value.(*ast.InfixExpressionValues)
+	ret := ifStmt.Cond[1].Consequence.Seq[0].(*ast.ReturnStatement)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, input},
+		{assign, "x = uniformChoice(choices=[1, 2], unit=userid);"},
+		{call, "uniformChoice(choices=[1, 2], unit=userid)"},
+		{call.Args["choices"].(ast.Node), "[1, 2]"},
+		{call.Args["unit"].(ast.Node), "userid"},
+		{ifStmt, "if (x != 1) {\n  y = x - 2;\n} else {\n  return f();\n}"},
+		{&ifStmt.Cond[0], "if (x != 1) {\n  y = x - 2;\n}"},
+		{&ifStmt.Cond[1], "else {\n  return f();\n}"},
+		{ifStmt.Cond[0].Consequence, "{\n  y = x - 2;\n}"},
+		{neq, "x != 1"},
+		{neq.Value.(ast.Node), "x != 1"},
+		{inner, "y = x - 2;"},
+		{diff, "x - 2"},
+		{diff.Values[1].(ast.Node), "2"},
+		{ret, "return f();"},
+		{ret.Value.(ast.Node), "f()"},
+	}
+	for i, tc := range tests {
+		if actual := text(tc.node); actual != tc.expected {
+			t.Errorf("span[%d] wrong. expected=%q, got=%q", i, tc.expected, actual)
+		}
+	}
+
+	if span := ifStmt.SourceSpan(); span.Start.Line != 2 || span.Start.Column != 1 || span.End.Line != 6 || span.End.Column != 2 {
+		t.Errorf("if statement span wrong. expected=2:1-6:2, got=%s-%s", span.Start, span.End)
+	}
+}
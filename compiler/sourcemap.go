@@ -0,0 +1,100 @@
+package compiler
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/biased-unit/planout-golang/compiler/ast"
+	"github.com/biased-unit/planout-golang/compiler/token"
+)
+
+// SourceMap maps the nodes of a compiled program to the part of the script they were compiled from.
+// The nodes are identified by their JSON Pointer (RFC 6901) in the compiled JSON, such as "/seq/1/value"
+// for the value of the second statement, and "" for the program itself.
+type SourceMap map[string]Location
+
+// Location is the part of a script a node was compiled from
+type Location struct {
+	Start token.Position `json:"start"`
+	End   token.Position `json:"end"`
+}
+
+func (l Location) String() string {
+	return l.Start.String()
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// buildSourceMap records the location of each node of the program. Literal numbers, strings and
+// booleans have no location of their own.
+func buildSourceMap(program *ast.Program) SourceMap {
+	sm := SourceMap{}
+	sm.add(program, "")
+	return sm
+}
+
+func (sm SourceMap) add(node interface{}, path string) {
+	if n, ok := node.(ast.Node); ok {
+		if span := n.SourceSpan(); span.Start.Line > 0 {
+			sm[path] = Location{Start: span.Start, End: span.End}
+		}
+	}
+
+	switch n := node.(type) {
+	case *ast.Program:
+		sm.addStatements(n.Seq, path+"/seq")
+	case *ast.BlockStatement:
+		sm.addStatements(n.Seq, path+"/seq")
+	case *ast.AssignmentStatement:
+		sm.add(n.Value, path+"/value")
+	case *ast.ReturnStatement:
+		sm.add(n.Value, path+"/value")
+	case *ast.IfStatement:
+		for i := range n.Cond {
+			sm.add(&n.Cond[i], path+"/cond/"+strconv.Itoa(i))
+		}
+	case *ast.Conditional:
+		sm.add(n.Condition, path+"/if")
+		if n.Consequence != nil {
+			sm.add(n.Consequence, path+"/then")
+		}
+	case *ast.SwitchStatement:
+		for i := range n.Cases {
+			sm.add(&n.Cases[i], path+"/cases/"+strconv.Itoa(i))
+		}
+	case *ast.Case:
+		sm.add(n.Condition, path+"/condidion")
+		sm.add(n.Result, path+"/result")
+	case *ast.PrefixExpression:
+		sm.add(n.Value, path+"/value")
+	case *ast.InfixExpressionLeftRight:
+		sm.add(n.Left, path+"/left")
+		sm.add(n.Right, path+"/right")
+	case *ast.InfixExpressionValues:
+		sm.add(n.Values[0], path+"/values/0")
+		sm.add(n.Values[1], path+"/values/1")
+	case *ast.ArrayLiteral:
+		for i, v := range n.Values {
+			sm.add(v, path+"/values/"+strconv.Itoa(i))
+		}
+	case *ast.IndexExpression:
+		sm.add(n.Base, path+"/base")
+		sm.add(n.Index, path+"/index")
+	case *ast.FunctionCallOneArg:
+		sm.add(n.Value, path+"/value")
+	case *ast.FunctionCallManyArgs:
+		for i, v := range n.Values {
+			sm.add(v, path+"/values/"+strconv.Itoa(i))
+		}
+	case *ast.FunctionCallNamedArgs:
+		for _, name := range n.ArgNames() {
+			sm.add(n.Args[name], path+"/"+pointerEscaper.Replace(name))
+		}
+	}
+}
+
+func (sm SourceMap) addStatements(seq []ast.Statement, path string) {
+	for i, stmt := range seq {
+		sm.add(stmt, path+"/"+strconv.Itoa(i))
+	}
+}
@@ -0,0 +1,34 @@
+// Compiles the scripts of this directory with the official PlanOut compiler, to the JSON files that
+// TestCompiler_RunStrictFixtures compares the output of the strict compiler with, byte for byte.
+//
+//   node generate.js path/to/planout/compiler/planout.js
+//
+// The official compiler is compiler/planout.js of https://github.com/facebook/planout, the parser that
+// Jison generates from compiler/planout.jison. The scripts are compiled like the PlanOut editor does,
+// then written with JSON.stringify and an indentation of two spaces. The SHA-1 of the compiler used is
+// recorded in COMPILER, so that the fixtures can be traced back to the version they come from.
+
+const crypto = require('crypto');
+const fs = require('fs');
+const path = require('path');
+
+if (process.argv.length !== 3) {
+  console.error('usage: node generate.js path/to/planout/compiler/planout.js');
+  process.exit(2);
+}
+
+const compilerPath = path.resolve(process.argv[2]);
+const planout = require(compilerPath);
+
+for (const file of fs.readdirSync(__dirname).sort()) {
+  if (path.extname(file) !== '.planout') {
+    continue;
+  }
+  const script = fs.readFileSync(path.join(__dirname, file), 'utf8');
+  const code = planout.parse(script);
+  fs.writeFileSync(path.join(__dirname, path.basename(file, '.planout') + '.json'), JSON.stringify(code, null, 2));
+  console.log(file);
+}
+
+const sha1 = crypto.createHash('sha1').update(fs.readFileSync(compilerPath)).digest('hex');
+fs.writeFileSync(path.join(__dirname, 'COMPILER'), 'facebook/planout compiler/planout.js sha1 ' + sha1 + '\n');
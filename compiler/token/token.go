@@ -3,9 +3,28 @@ package token
 import "fmt"
 
 type Token struct {
-	Type Type
-	Val  string
-	Line int
+	Type   Type
+	Val    string
+	Line   int
+	Column int      // column of the first character, counted in characters from 1
+	Offset int      // byte offset of the first character
+	End    Position // position just past the last character
+}
+
+// Pos returns the position of the first character of the token
+func (i Token) Pos() Position {
+	return Position{Offset: i.Offset, Line: i.Line, Column: i.Column}
+}
+
+// Position is a location in a PlanOut script
+type Position struct {
+	Offset int `json:"offset"` // byte offset, starting at 0
+	Line   int `json:"line"`   // line number, starting at 1
+	Column int `json:"column"` // column number in characters, starting at 1
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 func (i Token) String() string {
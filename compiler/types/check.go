@@ -0,0 +1,449 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/biased-unit/planout-golang/compiler/ast"
+	"github.com/biased-unit/planout-golang/compiler/token"
+)
+
+// Error is a type error located in the script
+type Error struct {
+	Start, End token.Position
+	Msg        string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Start, e.Msg)
+}
+
+// Span returns the positions of the first character and just past the last character
+// of the expression with the error
+func (e Error) Span() (token.Position, token.Position) {
+	return e.Start, e.End
+}
+
+// Message returns the error without its position
+func (e Error) Message() string {
+	return e.Msg
+}
+
+// numberArgs are the arguments of the random operators that must be numbers
+var numberArgs = map[string]bool{
+	"p":       true,
+	"min":     true,
+	"max":     true,
+	"draws":   true,
+	"mean":    true,
+	"sd":      true,
+	"rate":    true,
+	"percent": true,
+	"n":       true,
+}
+
+// Check infers the types of the parameters assigned by a program, and returns the type errors in the order
+// of the source. The inputs are the variables read but not assigned by the program. With nil inputs, they
+// have any type; otherwise reading a variable that is neither assigned nor declared is an error.
+func Check(program *ast.Program, inputs Schema) (Schema, []error) {
+	c := &checker{inputs: inputs, outputs: make(Schema), assigned: make(map[string]bool)}
+	ast.Inspect(program, func(node interface{}) bool {
+		if s, ok := node.(*ast.AssignmentStatement); ok {
+			c.assigned[s.Var] = true
+		}
+		return true
+	})
+
+	c.statements(program.Seq, make(Schema))
+
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		return c.errors[i].(Error).Start.Offset < c.errors[j].(Error).Start.Offset
+	})
+	return c.outputs, c.errors
+}
+
+type checker struct {
+	inputs   Schema
+	outputs  Schema          // the join of the types assigned to each parameter
+	assigned map[string]bool // variables assigned anywhere in the script
+	errors   []error
+}
+
+// errorf records an error at node, or at the enclosing node at if node has no position
+func (c *checker) errorf(node, at interface{}, format string, args ...interface{}) {
+	span, ok := node.(ast.Node)
+	if !ok {
+		span, _ = at.(ast.Node)
+	}
+	err := Error{Msg: fmt.Sprintf(format, args...)}
+	if span != nil {
+		err.Start, err.End = span.SourceSpan().Start, span.SourceSpan().End
+	}
+	c.errors = append(c.errors, err)
+}
+
+// statements checks a sequence of statements, with vars holding the types of the variables assigned so far
+func (c *checker) statements(seq []ast.Statement, vars Schema) {
+	for _, stmt := range seq {
+		c.statement(stmt, vars)
+	}
+}
+
+func (c *checker) statement(stmt ast.Statement, vars Schema) {
+	switch s := stmt.(type) {
+	case *ast.AssignmentStatement:
+		t := c.expression(s.Value, s, vars)
+		vars[s.Var] = t
+		if prev, ok := c.outputs[s.Var]; ok {
+			t = Join(prev, t)
+		}
+		c.outputs[s.Var] = t
+	case *ast.ReturnStatement:
+		c.expression(s.Value, s, vars)
+	case *ast.IfStatement:
+		branches := make([]Schema, 0, len(s.Cond))
+		for _, cond := range s.Cond {
+			c.condition(cond.Condition, s, vars)
+			branch := copySchema(vars)
+			if cond.Consequence != nil {
+				c.statements(cond.Consequence.Seq, branch)
+			}
+			branches = append(branches, branch)
+		}
+		merge(vars, branches)
+	case *ast.SwitchStatement:
+		branches := make([]Schema, 0, len(s.Cases))
+		for _, cs := range s.Cases {
+			c.condition(cs.Condition, s, vars)
+			branch := copySchema(vars)
+			c.statement(cs.Result, branch)
+			branches = append(branches, branch)
+		}
+		merge(vars, branches)
+	}
+}
+
+func copySchema(s Schema) Schema {
+	cp := make(Schema, len(s))
+	for name, t := range s {
+		cp[name] = t
+	}
+	return cp
+}
+
+// merge sets the types of the variables after a branch was taken: the join of their types in the branches
+func merge(vars Schema, branches []Schema) {
+	for _, branch := range branches {
+		for name, t := range branch {
+			if prev, ok := vars[name]; ok {
+				t = Join(prev, t)
+			}
+			vars[name] = t
+		}
+	}
+}
+
+// condition checks an expression tested for truth
+func (c *checker) condition(exp ast.Expression, at interface{}, vars Schema) {
+	if t := c.expression(exp, at, vars); t.Kind == Array || t.Kind == Map {
+		c.errorf(exp, at, "cannot use %s as a condition", t)
+	}
+}
+
+// number checks an expression used as a number
+func (c *checker) number(exp ast.Expression, at interface{}, vars Schema, op string) Type {
+	t := c.expression(exp, at, vars)
+	if !t.isNumber() {
+		c.errorf(exp, at, "%s expects a number, got %s", op, t)
+		return Of(Any)
+	}
+	return t
+}
+
+// array checks an expression used as an array
+func (c *checker) array(exp ast.Expression, at interface{}, vars Schema, op string) Type {
+	t := c.expression(exp, at, vars)
+	if t.known() && t.Kind != Array {
+		c.errorf(exp, at, "%s expects an array, got %s", op, t)
+		return ArrayOf(Of(Any))
+	}
+	return t
+}
+
+// arithmetic returns the type of the result of an arithmetic operation on numbers
+func arithmetic(t, u Type) Type {
+	if t.Kind == Integer && u.Kind == Integer {
+		return t
+	}
+	if t.known() && u.known() {
+		return Of(Number)
+	}
+	return Of(Any)
+}
+
+// expression returns the type of the value of an expression. at is the enclosing node, to locate the errors
+// of the literals, which have no position.
+func (c *checker) expression(exp ast.Expression, at interface{}, vars Schema) Type {
+	if node, ok := exp.(ast.Node); ok {
+		at = node
+	}
+
+	switch e := exp.(type) {
+	case ast.IntegerLiteral:
+		return Of(Integer)
+	case ast.FloatLiteral:
+		return Of(Number)
+	case ast.StringLiteral:
+		return Of(String)
+	case ast.Boolean:
+		return Of(Boolean)
+	case *ast.NullLiteral:
+		return Of(Null)
+	case *ast.JSONLiteral:
+		return valueType(e.Value)
+	case *ast.Identifier:
+		return c.variable(e, vars)
+	case *ast.ArrayLiteral:
+		elem := Of(Null)
+		for _, v := range e.Values {
+			elem = Join(elem, c.expression(v, at, vars))
+		}
+		if elem.Kind == Null {
+			elem = Of(Any)
+		}
+		return ArrayOf(elem)
+	case *ast.IndexExpression:
+		return c.index(e, vars)
+	case *ast.PrefixExpression:
+		if e.Op == "negative" {
+			return c.number(e.Value, at, vars, e.Op)
+		}
+		c.condition(e.Value, at, vars)
+		return Of(Boolean)
+	case *ast.InfixExpressionLeftRight:
+		return c.infix(e, vars)
+	case *ast.InfixExpressionValues:
+		return c.values(e.Op, e.Values[:], at, vars)
+	case *ast.FunctionCallNoArgs:
+		return Of(Any)
+	case *ast.FunctionCallOneArg:
+		return c.call(e.Op, []ast.Expression{e.Value}, at, vars)
+	case *ast.FunctionCallManyArgs:
+		return c.call(e.Op, e.Values, at, vars)
+	case *ast.FunctionCallNamedArgs:
+		return c.namedCall(e, vars)
+	}
+	return Of(Any)
+}
+
+func (c *checker) variable(id *ast.Identifier, vars Schema) Type {
+	if t, ok := vars[id.Var]; ok {
+		return t
+	}
+	if c.inputs == nil {
+		return Of(Any)
+	}
+	if t, ok := c.inputs[id.Var]; ok {
+		return t
+	}
+	// a parameter read before it is assigned is not an input
+	if !c.assigned[id.Var] {
+		c.errorf(id, nil, "undeclared input: %s", id.Var)
+	}
+	return Of(Any)
+}
+
+func (c *checker) index(e *ast.IndexExpression, vars Schema) Type {
+	base := c.expression(e.Base, e, vars)
+	index := c.expression(e.Index, e, vars)
+	switch {
+	case base.Kind == Array:
+		if !index.isNumber() {
+			c.errorf(e.Index, e, "cannot index an array with %s", index)
+		}
+		return base.ElemType()
+	case base.known() && base.Kind != Map:
+		c.errorf(e.Base, e, "cannot index %s", base)
+	}
+	return Of(Any)
+}
+
+func (c *checker) infix(e *ast.InfixExpressionLeftRight, vars Schema) Type {
+	switch e.Op {
+	case "%", "/":
+		left := c.number(e.Left, e, vars, e.Op)
+		right := c.number(e.Right, e, vars, e.Op)
+		if e.Op == "/" {
+			return Of(Number)
+		}
+		return arithmetic(left, right)
+	}
+
+	left := c.expression(e.Left, e, vars)
+	right := c.expression(e.Right, e, vars)
+	if e.Op == "equals" && !compatible(left, right) || e.Op != "equals" && !comparable(left, right) {
+		c.errorf(e, nil, "cannot compare %s and %s", left, right)
+	}
+	return Of(Boolean)
+}
+
+// values returns the type of an operator on a list of values
+func (c *checker) values(op string, values []ast.Expression, at interface{}, vars Schema) Type {
+	switch op {
+	case "and", "or":
+		for _, v := range values {
+			c.condition(v, at, vars)
+		}
+		return Of(Boolean)
+	case "product":
+		result := Of(Integer)
+		for _, v := range values {
+			result = arithmetic(result, c.number(v, at, vars, op))
+		}
+		return result
+	case "sum":
+		// numbers are added, and strings concatenated
+		var result Type
+		for i, v := range values {
+			t := c.expression(v, at, vars)
+			if i == 0 {
+				result = t
+				if !t.isNumber() && t.Kind != String {
+					c.errorf(v, at, "cannot add %s", t)
+					result = Of(Any)
+				}
+				continue
+			}
+			switch {
+			case result.isNumber() && t.isNumber():
+				result = arithmetic(result, t)
+			case result.Kind == String && (t.Kind == String || !t.known()):
+				result = Of(String)
+			case !result.known() && t.Kind == String:
+				result = Of(Any)
+			default:
+				c.errorf(at, nil, "cannot add %s and %s", result, t)
+				result = Of(Any)
+			}
+		}
+		return result
+	case "coalesce":
+		result := Of(Null)
+		for _, v := range values {
+			result = Join(result, c.expression(v, at, vars))
+		}
+		return result
+	case "min", "max":
+		result := Of(Null)
+		for _, v := range values {
+			t := c.expression(v, at, vars)
+			if !comparable(result, t) {
+				c.errorf(v, at, "cannot compare %s and %s", result, t)
+			}
+			result = Join(result, t)
+		}
+		return result
+	}
+	for _, v := range values {
+		c.expression(v, at, vars)
+	}
+	return Of(Any)
+}
+
+// call returns the type of a call with positional arguments
+func (c *checker) call(op string, args []ast.Expression, at interface{}, vars Schema) Type {
+	switch op {
+	case "length":
+		if len(args) == 1 {
+			c.array(args[0], at, vars, op)
+			return Of(Integer)
+		}
+	case "round":
+		if len(args) == 1 {
+			c.number(args[0], at, vars, op)
+			return Of(Number)
+		}
+	case "min", "max":
+		if len(args) == 1 {
+			return c.array(args[0], at, vars, op).ElemType()
+		}
+		return c.values(op, args, at, vars)
+	case "product", "sum", "and", "or", "coalesce":
+		if len(args) > 1 {
+			return c.values(op, args, at, vars)
+		}
+	}
+	for _, arg := range args {
+		c.expression(arg, at, vars)
+	}
+	return Of(Any)
+}
+
+// namedCall returns the type of a call with named arguments, such as the random operators
+func (c *checker) namedCall(call *ast.FunctionCallNamedArgs, vars Schema) Type {
+	args := make(map[string]Type, len(call.Args))
+	for _, name := range call.ArgNames() {
+		arg := call.Args[name]
+		switch {
+		case name == "choices" && ast.IsRandomOp(call.Op):
+			args[name] = c.array(arg, call, vars, call.Op)
+		case name == "weights" && ast.IsRandomOp(call.Op):
+			weights := c.array(arg, call, vars, call.Op)
+			if elem := weights.ElemType(); !elem.isNumber() {
+				c.errorf(arg, call, "%s expects numbers as weights, got %s", call.Op, weights)
+			}
+			args[name] = weights
+		case numberArgs[name] && ast.IsRandomOp(call.Op):
+			args[name] = c.number(arg, call, vars, call.Op)
+		default:
+			args[name] = c.expression(arg, call, vars)
+		}
+	}
+
+	choices, ok := args["choices"]
+	if !ok {
+		choices = ArrayOf(Of(Any))
+	}
+	switch call.Op {
+	case "map":
+		return Of(Map)
+	case "uniformChoice", "weightedChoice", "saltedChoice":
+		return choices.ElemType()
+	case "sample", "shuffle", "bernoulliFilter":
+		return choices
+	case "bernoulliTrial", "rollout", "randomInteger", "hash", "bucket":
+		return Of(Integer)
+	case "randomFloat", "randomNormal", "randomExponential":
+		return Of(Number)
+	}
+	return Of(Any)
+}
+
+// valueType returns the type of a decoded JSON value
+func valueType(v interface{}) Type {
+	switch v := v.(type) {
+	case nil:
+		return Of(Null)
+	case bool:
+		return Of(Boolean)
+	case float64:
+		if v == float64(int64(v)) {
+			return Of(Integer)
+		}
+		return Of(Number)
+	case string:
+		return Of(String)
+	case []interface{}:
+		elem := Of(Null)
+		for _, e := range v {
+			elem = Join(elem, valueType(e))
+		}
+		if elem.Kind == Null {
+			elem = Of(Any)
+		}
+		return ArrayOf(elem)
+	case map[string]interface{}, *ast.JSONObject:
+		return Of(Map)
+	}
+	return Of(Any)
+}
@@ -0,0 +1,153 @@
+// Package types infers the types of the parameters of PlanOut scripts, and reports the operations that
+// would fail at runtime on the types of their operands, given the types of the inputs of the scripts.
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind is the kind of value of a type
+type Kind int
+
+const (
+	Any Kind = iota // any value, when the type is not known
+	Null
+	Boolean
+	Integer
+	Number // any number, integer or not
+	String
+	Array
+	Map
+)
+
+var kindNames = [...]string{
+	Any:     "any",
+	Null:    "null",
+	Boolean: "boolean",
+	Integer: "integer",
+	Number:  "number",
+	String:  "string",
+	Array:   "array",
+	Map:     "map",
+}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// Type is the type of a value. Arrays have the type of their elements.
+type Type struct {
+	Kind Kind
+	Elem *Type // type of the elements of an array, nil for any
+}
+
+// Of returns the type of the values of a kind
+func Of(kind Kind) Type {
+	return Type{Kind: kind}
+}
+
+// ArrayOf returns the type of arrays of elem
+func ArrayOf(elem Type) Type {
+	return Type{Kind: Array, Elem: &elem}
+}
+
+// Parse parses the name of a type: any, null, boolean, integer, number, string, map,
+// array for an array of any values, or array<T> for an array of values of type T.
+func Parse(name string) (Type, error) {
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(name, "array<") && strings.HasSuffix(name, ">") {
+		elem, err := Parse(name[len("array<") : len(name)-1])
+		if err != nil {
+			return Type{}, err
+		}
+		return ArrayOf(elem), nil
+	}
+	for kind, kindName := range kindNames {
+		if name == kindName {
+			return Of(Kind(kind)), nil
+		}
+	}
+	return Type{}, fmt.Errorf("unknown type: %q", name)
+}
+
+// ElemType returns the type of the elements of an array
+func (t Type) ElemType() Type {
+	if t.Elem == nil {
+		return Of(Any)
+	}
+	return *t.Elem
+}
+
+func (t Type) String() string {
+	if t.Kind == Array && t.Elem != nil && t.Elem.Kind != Any {
+		return "array<" + t.Elem.String() + ">"
+	}
+	return t.Kind.String()
+}
+
+func (t Type) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *Type) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// Equal reports whether two types are the same
+func (t Type) Equal(u Type) bool {
+	if t.Kind != u.Kind {
+		return false
+	}
+	return t.Kind != Array || t.ElemType().Equal(u.ElemType())
+}
+
+// Join returns the most precise type of the values of both types.
+// Null values are not tracked, so null joined with a type is that type.
+func Join(t, u Type) Type {
+	switch {
+	case t.Equal(u):
+		return t
+	case t.Kind == Null:
+		return u
+	case u.Kind == Null:
+		return t
+	case t.isNumber() && u.isNumber() && t.Kind != Any && u.Kind != Any:
+		return Of(Number)
+	case t.Kind == Array && u.Kind == Array:
+		return ArrayOf(Join(t.ElemType(), u.ElemType()))
+	}
+	return Of(Any)
+}
+
+// known reports whether the values of the type have a definite kind
+func (t Type) known() bool {
+	return t.Kind != Any && t.Kind != Null
+}
+
+// isNumber reports whether the values of the type may be numbers
+func (t Type) isNumber() bool {
+	return !t.known() || t.Kind == Integer || t.Kind == Number
+}
+
+// comparable reports whether the values of two types may be ordered: strings with strings, and numbers with numbers
+func comparable(t, u Type) bool {
+	if !t.known() || !u.known() {
+		return true
+	}
+	return t.Kind == String && u.Kind == String || t.isNumber() && u.isNumber()
+}
+
+// compatible reports whether the values of two types may be equal
+func compatible(t, u Type) bool {
+	return !t.known() || !u.known() || t.Kind == u.Kind || t.isNumber() && u.isNumber()
+}
+
+// Schema maps the names of the inputs or the parameters of a script to their types.
+// It marshals to a JSON object of the names of the types, such as {"userid": "string"}.
+type Schema map[string]Type
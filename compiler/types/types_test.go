@@ -0,0 +1,210 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/biased-unit/planout-golang/compiler/lexer"
+	"github.com/biased-unit/planout-golang/compiler/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	for _, name := range []string{"any", "null", "boolean", "integer", "number", "string", "map", "array", "array<string>", "array<array<integer>>"} {
+		typ, err := Parse(name)
+		require.NoError(t, err)
+		require.Equal(t, name, typ.String())
+	}
+
+	typ, err := Parse("array<any>")
+	require.NoError(t, err)
+	require.Equal(t, "array", typ.String())
+
+	_, err = Parse("array<strin>")
+	require.EqualError(t, err, `unknown type: "strin"`)
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		t, u, expected string
+	}{
+		{"integer", "integer", "integer"},
+		{"integer", "number", "number"},
+		{"null", "string", "string"},
+		{"string", "integer", "any"},
+		{"array<integer>", "array<number>", "array<number>"},
+		{"array<integer>", "array<string>", "array"},
+		{"map", "array", "any"},
+	}
+	for _, tc := range tests {
+		typ, err := Parse(tc.t)
+		require.NoError(t, err)
+		other, err := Parse(tc.u)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, Join(typ, other).String())
+		require.Equal(t, tc.expected, Join(other, typ).String())
+	}
+}
+
+func TestSchema_JSON(t *testing.T) {
+	var schema Schema
+	require.NoError(t, json.Unmarshal([]byte(`{"userid": "string", "tags": "array<string>", "age": "integer"}`), &schema))
+	require.Equal(t, Schema{"userid": Of(String), "tags": ArrayOf(Of(String)), "age": Of(Integer)}, schema)
+
+	out, err := json.Marshal(schema)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"userid": "string", "tags": "array<string>", "age": "integer"}`, string(out))
+
+	require.Error(t, json.Unmarshal([]byte(`{"userid": "str"}`), &schema))
+}
+
+func check(t *testing.T, input string, inputs Schema) (Schema, []string) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	outputs, errs := Check(program, inputs)
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return outputs, messages
+}
+
+func TestCheck_Outputs(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"literals and operators",
+			"a = 1; b = 1.5; c = 'x'; d = true; e = a + 2; f = a * b; g = a / 2; h = a % 2; i = a < b; j = -a; k = c + 'y';",
+			`{"a": "integer", "b": "number", "c": "string", "d": "boolean", "e": "integer", "f": "number", "g": "number",
+			  "h": "integer", "i": "boolean", "j": "integer", "k": "string"}`,
+		},
+		{
+			"arrays, maps and indexing",
+			"a = [1, 2.5]; b = a[0]; c = @[\"x\", \"y\"]; d = c[1]; e = map(x=1); f = e['x']; g = length(a); h = [];",
+			`{"a": "array<number>", "b": "number", "c": "array<string>", "d": "string", "e": "map", "f": "any",
+			  "g": "integer", "h": "array"}`,
+		},
+		{
+			"random operators",
+			"a = uniformChoice(choices=['a', 'b'], unit=userid);\n" +
+				"b = weightedChoice(choices=[1, 2], weights=[0.5, 0.5], unit=userid);\n" +
+				"c = sample(choices=['a', 'b'], draws=1, unit=userid);\n" +
+				"d = bernoulliTrial(p=0.5, unit=userid);\n" +
+				"e = randomFloat(min=0, max=1, unit=userid);\n" +
+				"f = randomInteger(min=0, max=10, unit=userid);",
+			`{"a": "string", "b": "integer", "c": "array<string>", "d": "integer", "e": "number", "f": "integer"}`,
+		},
+		{
+			"inputs and branches",
+			"if (country == 'US') {\n  x = 1;\n  y = 'a';\n} else {\n  x = 0.5;\n  y = 2;\n}\nz = x + age;\nw = score ?? 0;",
+			`{"x": "number", "y": "any", "z": "number", "w": "number"}`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			outputs, errs := check(t, tc.input, Schema{
+				"userid":  Of(String),
+				"country": Of(String),
+				"age":     Of(Integer),
+				"score":   Of(Number),
+			})
+			require.Empty(t, errs)
+
+			actual, err := json.Marshal(outputs)
+			require.NoError(t, err)
+			require.JSONEq(t, tc.expected, string(actual))
+		})
+	}
+}
+
+func TestCheck_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			"comparisons",
+			"a = country > 1;\nb = age == 'x';\nc = country == 'US';\nd = min(age, country);",
+			[]string{
+				"1:5: cannot compare string and integer",
+				"2:5: cannot compare integer and string",
+				"4:14: cannot compare integer and string",
+			},
+		},
+		{
+			"arithmetic",
+			"a = country + 1;\nb = age * 'x';\nc = -tags;\nd = age / country;",
+			[]string{
+				"1:5: cannot add string and integer",
+				"2:5: product expects a number, got string",
+				"3:6: negative expects a number, got array<string>",
+				"4:11: / expects a number, got string",
+			},
+		},
+		{
+			"indexing",
+			"a = age[0];\nb = tags['x'];\nc = tags[0] + 1;",
+			[]string{
+				"1:5: cannot index integer",
+				"2:5: cannot index an array with string",
+				"3:5: cannot add string and integer",
+			},
+		},
+		{
+			"operator arguments",
+			"a = uniformChoice(choices=country, unit=userid);\nb = bernoulliTrial(p='x', unit=userid);\nc = weightedChoice(choices=[1, 2], weights=tags, unit=userid);\nd = length(age);\ne = randomNormal(mean=0, sd='x', unit=userid);",
+			[]string{
+				"1:27: uniformChoice expects an array, got string",
+				"2:5: bernoulliTrial expects a number, got string",
+				"3:44: weightedChoice expects numbers as weights, got array<string>",
+				"4:12: length expects an array, got integer",
+				"5:5: randomNormal expects a number, got string",
+			},
+		},
+		{
+			"conditions",
+			"if (tags) {\n  a = 1;\n}\nb = !tags || age;",
+			[]string{
+				"1:5: cannot use array<string> as a condition",
+				"4:6: cannot use array<string> as a condition",
+			},
+		},
+		{
+			"undeclared inputs",
+			"a = b;\nb = userid;\nc = userd;",
+			[]string{
+				"3:5: undeclared input: userd",
+			},
+		},
+		{
+			"assigned types",
+			"a = 'x';\nb = a > 1;\na = 2;\nc = a > 1;",
+			[]string{
+				"2:5: cannot compare string and integer",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, errs := check(t, tc.input, Schema{
+				"userid":  Of(String),
+				"country": Of(String),
+				"age":     Of(Integer),
+				"tags":    ArrayOf(Of(String)),
+			})
+			require.Equal(t, tc.expected, errs)
+		})
+	}
+}
+
+func TestCheck_NoInputs(t *testing.T) {
+	outputs, errs := check(t, "a = b > 1;\nc = d + e;\nf = 'x' > 1;", nil)
+	require.Equal(t, []string{"3:5: cannot compare string and integer"}, errs)
+	require.Equal(t, Schema{"a": Of(Boolean), "c": Of(Any), "f": Of(Boolean)}, outputs)
+}
@@ -18,7 +18,7 @@ package planout
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -192,40 +192,41 @@ func TestCoreOps(t *testing.T) {
 	// Test Coalesce
 	expt, _ = runConfig([]byte(`{"op": "coalesce", "values": {"op": "array", "values": [100, 200, 300]}}`))
 	x, _ = expt.Get("x")
-	lhs := fmt.Sprintf("%v", x)
-	rhs := fmt.Sprintf("%v", []interface{}{100, 200, 300})
-	if compare(lhs, rhs) != 0 {
-		t.Errorf("Variable x. Expected [100, 200, 300]. Actual %v\n", x)
+	if compare(x, 100) != 0 {
+		t.Errorf("Variable x. Expected 100. Actual %v\n", x)
 	}
 
 	expt, _ = runConfig([]byte(`{"op": "coalesce", "values": [100, 200, 300, null]}`))
 	x, _ = expt.Get("x")
-	lhs = fmt.Sprintf("%v", x)
-	rhs = fmt.Sprintf("%v", []interface{}{100, 200, 300})
-	if compare(lhs, rhs) != 0 {
-		t.Errorf("Variable x. Expected [100, 200, 300]. Actual %v\n", x)
+	if compare(x, 100) != 0 {
+		t.Errorf("Variable x. Expected 100. Actual %v\n", x)
 	}
 
 	expt, _ = runConfig([]byte(`{"op": "coalesce", "values": [null]}`))
-	x, _ = expt.Get("x")
-	if len(x.([]interface{})) != 0 {
-		t.Errorf("Variable x. Expected []. Actual %v\n", x)
+	x, exists := expt.Get("x")
+	if !exists || x != nil {
+		t.Errorf("Variable x. Expected null. Actual %v\n", x)
 	}
 
 	expt, _ = runConfig([]byte(`{"op": "coalesce", "values": [null, 42, null]}`))
 	x, _ = expt.Get("x")
-	lhs = fmt.Sprintf("%v", x)
-	rhs = fmt.Sprintf("%v", []interface{}{42})
-	if compare(lhs, rhs) != 0 {
-		t.Errorf("Variable x. Expected [42]. Actual %v\n", x)
+	if compare(x, 42) != 0 {
+		t.Errorf("Variable x. Expected 42. Actual %v\n", x)
 	}
 
 	expt, _ = runConfig([]byte(`{"op": "coalesce", "values": [null, null, 43]}`))
 	x, _ = expt.Get("x")
-	lhs = fmt.Sprintf("%v", x)
-	rhs = fmt.Sprintf("%v", []interface{}{43})
-	if compare(lhs, rhs) != 0 {
-		t.Errorf("Variable x. Expected [43]. Actual %v\n", x)
+	if compare(x, 43) != 0 {
+		t.Errorf("Variable x. Expected 43. Actual %v\n", x)
+	}
+
+	// a ?? b
+	expt, _ = runExperiment([]byte(`{"op":"seq",
+					"seq":[{"op":"set","var":"a","value":null},
+						{"op":"set","var":"x","value":{"op":"coalesce","values":[{"op":"get","var":"a"},"b"]}}]}`))
+	x, _ = expt.Get("x")
+	if compare(x, "b") != 0 {
+		t.Errorf("Variable x. Expected 'b'. Actual %v\n", x)
 	}
 
 	// Test Length
@@ -476,3 +477,215 @@ func TestCoreOps(t *testing.T) {
 		t.Errorf("Variable x. Expected False . Actual %v\n", expt.InExperiment)
 	}
 }
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []struct {
+		config   string
+		expected interface{}
+	}{
+		{`{"op": "sum", "values": [1, 1]}`, int64(2)},
+		{`{"op": "sum", "values": [1, 1.5]}`, 2.5},
+		{`{"op": "product", "values": [2, 3, 4]}`, int64(24)},
+		{`{"op": "product", "values": [2, 0.5]}`, 1.0},
+		{`{"op": "negative", "value": 5}`, int64(-5)},
+		{`{"op": "negative", "value": 2.5}`, -2.5},
+		{`{"op": "%", "left": 11, "right": 3}`, int64(2)},
+	}
+
+	for _, tt := range tests {
+		code, err := Decode([]byte(`{"op": "set", "var": "x", "value": ` + tt.config + `}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expt := &Interpreter{
+			Salt:      "test_salt",
+			Inputs:    map[string]interface{}{},
+			Outputs:   map[string]interface{}{},
+			Overrides: map[string]interface{}{},
+			Code:      code,
+		}
+		expt.Run()
+		x, _ := expt.Get("x")
+		if !reflect.DeepEqual(x, tt.expected) {
+			t.Errorf("%s. Expected %v (%T). Actual %v (%T)\n", tt.config, tt.expected, tt.expected, x, x)
+		}
+	}
+
+	// Integer inputs from Go keep their exact value in the unit string
+	if s, _ := toString(int64(9007199254740993)); s != "9007199254740993" {
+		t.Errorf("Unit string. Expected 9007199254740993. Actual %v\n", s)
+	}
+}
+
+func TestDivisionAndModulo(t *testing.T) {
+	tests := []struct {
+		name        string
+		op          string
+		left, right interface{}
+		expected    interface{}
+		err         error
+	}{
+		{"int division", "/", 3, 4, 0.75, nil},
+		{"int division exact", "/", 8, 2, 4.0, nil},
+		{"float division", "/", 7.5, 2.5, 3.0, nil},
+		{"negative division", "/", -3, 4, -0.75, nil},
+		{"division by zero", "/", 1, 0, nil, ErrDivisionByZero},
+		{"division by float zero", "/", 1.5, 0.0, nil, ErrDivisionByZero},
+		{"division of string", "/", "a", 2, nil, ErrUnsupportedType},
+		{"int modulo", "%", 11, 3, int64(2), nil},
+		{"negative dividend", "%", -7, 3, int64(2), nil},
+		{"negative divisor", "%", 7, -3, int64(-2), nil},
+		{"negative operands", "%", -7, -3, int64(-1), nil},
+		{"float modulo", "%", 7.5, 2, 1.5, nil},
+		{"negative float dividend", "%", -7.5, 2, 0.5, nil},
+		{"negative float divisor", "%", 7.5, -2, -0.5, nil},
+		{"modulo by zero", "%", 7, 0, nil, ErrDivisionByZero},
+		{"modulo by float zero", "%", 7.5, 0.0, nil, ErrDivisionByZero},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expt := &Interpreter{
+				Salt:      "test_salt",
+				Inputs:    map[string]interface{}{"left": tt.left, "right": tt.right},
+				Outputs:   map[string]interface{}{},
+				Overrides: map[string]interface{}{},
+				Code: map[string]interface{}{
+					"op":  "set",
+					"var": "x",
+					"value": map[string]interface{}{
+						"op":    tt.op,
+						"left":  map[string]interface{}{"op": "get", "var": "left"},
+						"right": map[string]interface{}{"op": "get", "var": "right"},
+					},
+				},
+			}
+
+			_, ok := expt.Run()
+			if tt.err != nil {
+				var evalErr *EvaluationError
+				if ok || !errors.As(expt.Err(), &evalErr) || !errors.Is(expt.Err(), tt.err) {
+					t.Errorf("Expected evaluation error %v. Actual ok=%v err=%v\n", tt.err, ok, expt.Err())
+				}
+				return
+			}
+
+			x, _ := expt.Get("x")
+			if !ok || !reflect.DeepEqual(x, tt.expected) {
+				t.Errorf("Expected %v (%T). Actual %v (%T), err=%v\n", tt.expected, tt.expected, x, x, expt.Err())
+			}
+		})
+	}
+}
+
+func TestNullSemantics(t *testing.T) {
+	tests := []struct {
+		config   string
+		expected bool
+	}{
+		{`{"op": "not", "value": null}`, true},
+		{`{"op": "and", "values": [true, null]}`, false},
+		{`{"op": "or", "values": [null, true]}`, true},
+		{`{"op": "equals", "left": null, "right": null}`, true},
+		{`{"op": "equals", "left": 1, "right": null}`, false},
+		{`{"op": "equals", "left": null, "right": "a"}`, false},
+		{`{"op": "<", "left": null, "right": 1}`, false},
+		{`{"op": "<=", "left": null, "right": null}`, false},
+		{`{"op": ">", "left": 1, "right": null}`, false},
+		{`{"op": ">=", "left": "a", "right": null}`, false},
+	}
+
+	for _, tt := range tests {
+		expt, ok := runConfig([]byte(tt.config))
+		x, _ := expt.Get("x")
+		if !ok || x != tt.expected {
+			t.Errorf("%s. Expected %v. Actual %v (err=%v)\n", tt.config, tt.expected, x, expt.Err())
+		}
+	}
+
+	// Conditions that evaluate to null are false
+	expt, _ := runExperiment([]byte(`
+		{"op": "cond",
+		"cond": [ {"if": null, "then": {"op": "set", "var": "x", "value": "x_0"}},
+			  {"if": true, "then": {"op": "set", "var": "x", "value": "x_1"}}]}`))
+	x, _ := expt.Get("x")
+	if compare(x, "x_1") != 0 {
+		t.Errorf("Variable x. Expected x_1. Actual %v\n", x)
+	}
+}
+
+func TestDeepEquality(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		expected bool
+	}{
+		{"equal arrays", `x = tags == ["a", "b"];`, true},
+		{"different order", `x = tags == ["b", "a"];`, false},
+		{"different length", `x = tags == ["a"];`, false},
+		{"not equal arrays", `x = tags != ["a", "c"];`, true},
+		{"json literals", `x = @{"a": [1, 2], "b": null} == @{"b": null, "a": [1, 2.0]};`, true},
+		{"different json literals", `x = @{"a": [1, 2]} == @{"a": [1, 3]};`, false},
+		{"map and input map", `x = @{"a": 1} == counts;`, true},
+		{"array and string", `x = tags == "a";`, false},
+		{"bools", `x = true == false;`, false},
+		{"null", `x = missing == null;`, true},
+		{"structs", `x = struct == other;`, true},
+		{"different structs", `x = struct == third;`, false},
+		{"struct pointers", `x = struct == pointer;`, true},
+		{"nested arrays", `x = [[1, 2], [3]] == [[1, 2], [3]];`, true},
+		{"int and string keys", `x = runes == @{"a": 1};`, false},
+		{"int keys of different types", `x = ids == int64Ids;`, true},
+		{"float and int keys", `x = floatIds == ids;`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Compile(tt.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expt := &Interpreter{
+				Salt: "test_salt",
+				Inputs: map[string]interface{}{
+					"tags":     []string{"a", "b"},
+					"counts":   map[string]int{"a": 1},
+					"missing":  nil,
+					"struct":   Struct{Member: 101, String: "test-string"},
+					"other":    Struct{Member: 101, String: "test-string"},
+					"third":    Struct{Member: 102, String: "test-string"},
+					"pointer":  &Struct{Member: 101, String: "test-string"},
+					"runes":    map[int]int{97: 1},
+					"ids":      map[int]int{1: 1},
+					"int64Ids": map[int64]int{1: 1},
+					"floatIds": map[float64]int{1.5: 1},
+				},
+				Outputs:   map[string]interface{}{},
+				Overrides: map[string]interface{}{},
+				Code:      code,
+			}
+
+			_, ok := expt.Run()
+			x, _ := expt.Get("x")
+			if !ok || x != tt.expected {
+				t.Errorf("%s. Expected %v. Actual %v (err=%v)\n", tt.script, tt.expected, x, expt.Err())
+			}
+		})
+	}
+}
+
+func TestIncomparableOrdering(t *testing.T) {
+	configs := []string{
+		`{"op": "<", "left": [1, 2], "right": 3}`,
+		`{"op": ">=", "left": "a", "right": 1}`,
+		`{"op": ">", "left": {"op": "map", "a": 1}, "right": {"op": "map", "a": 2}}`,
+	}
+
+	for _, config := range configs {
+		expt, ok := runConfig([]byte(config))
+		var evalErr *EvaluationError
+		if ok || !errors.As(expt.Err(), &evalErr) || !errors.Is(expt.Err(), ErrIncomparable) {
+			t.Errorf("%s. Expected ErrIncomparable. Actual ok=%v err=%v\n", config, ok, expt.Err())
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package planout
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/biased-unit/planout-golang/compiler"
+)
+
+var (
+	ErrDivisionByZero  = errors.New("division by zero")
+	ErrUnsupportedType = errors.New("unsupported operand type")
+	ErrIncomparable    = errors.New("incomparable types")
+	ErrInvalidArgument = errors.New("invalid argument")
+	ErrLimitExceeded   = errors.New("limit exceeded")
+)
+
+// EvaluationError is the error recorded by Run when an operator cannot be evaluated.
+type EvaluationError struct {
+	Op  string
+	Err error
+	// Location is the part of the script the operator was compiled from, when the Interpreter has a SourceMap.
+	// It is that of the closest enclosing operator in the map if the operator itself is not.
+	Location *compiler.Location
+}
+
+func (e *EvaluationError) Error() string {
+	if e.Location != nil {
+		return fmt.Sprintf("%v: Operator %s: %v", e.Location, e.Op, e.Err)
+	}
+	return fmt.Sprintf("Operator %s: %v", e.Op, e.Err)
+}
+
+func (e *EvaluationError) Unwrap() error {
+	return e.Err
+}
+
+// panicEvaluation aborts the current run with an EvaluationError for the operator
+func panicEvaluation(opstr string, err error) {
+	panic(&EvaluationError{Op: opstr, Err: err})
+}
+
+// recoveredError converts a value recovered from a panic during evaluation into an error
+func recoveredError(r interface{}) error {
+	if err, ok := r.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", r)
+}
@@ -17,6 +17,9 @@
 package planout
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"testing"
 )
 
@@ -24,6 +27,58 @@ func TestFixture01(t *testing.T) {
     testFixture("test/fixtures/1.json", t);
 }
 
+// TestFixture02 compares the serialized outputs with those this implementation produced
+// when 2_outputs.json was written, so that changes to the types of numbers or to the
+// assignments show up. They do not come from the reference implementation.
+func TestFixture02(t *testing.T) {
+	testFixtureOutputs("test/fixtures/2.json", "test/fixtures/2_outputs.json", t)
+}
+
+// TestFixtureReference compares the serialized outputs with those the reference Python
+// implementation asserts for the same script, salt and unit in planout/test/test_interpreter.py:
+// specific_goal is 1 and ratings_goal is 320, which only a group_size of 10 and a
+// ratings_per_user_goal of 32 give.
+func TestFixtureReference(t *testing.T) {
+	testFixtureOutputs("test/interpreter_test.json", "test/fixtures/interpreter_test_outputs.json", t)
+}
+
+func testFixtureOutputs(fixture, expectedOutputs string, t *testing.T) {
+	data, err := ioutil.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile(expectedOutputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expt := &Interpreter{
+		Salt:      "foo",
+		Evaluated: false,
+		Inputs:    map[string]interface{}{"userid": 123454},
+		Outputs:   map[string]interface{}{},
+		Overrides: map[string]interface{}{},
+		Code:      js,
+	}
+
+	outputs, ok := expt.Run()
+	if !ok {
+		t.Fatalf("Error running experiment %s\n", fixture)
+	}
+
+	actual, err := json.Marshal(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(expected), actual) {
+		t.Errorf("Outputs of %s. Expected %s. Actual %s\n", fixture, bytes.TrimSpace(expected), actual)
+	}
+}
+
 func testFixture(fixture string, t *testing.T) {
 	js := readTest(fixture)
 
@@ -0,0 +1,187 @@
+package planout
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Hasher maps the string built from the salts and units of a random operator,
+// such as "experiment_salt.parameter.userid", to a uniformly distributed value.
+// Hash must return a value in the range [0, 2^60), since random operators scale
+// it by 0xFFFFFFFFFFFFFFF to draw uniform numbers.
+//
+// Interpreters and namespaces use SHA1Hasher unless another Hasher is set.
+// Only SHA1Hasher produces the same assignments as the reference PlanOut implementations.
+type Hasher interface {
+	Hash(in string) uint64
+}
+
+// SHA1Hasher is the reference PlanOut hash: the first 15 hex digits of the SHA-1 digest.
+type SHA1Hasher struct{}
+
+func (SHA1Hasher) Hash(in string) uint64 {
+	return hash(in)
+}
+
+// XXHash64Hasher hashes with 64-bit xxHash and keeps the top 60 bits of the result,
+// so the same value can be computed offline as xxhash64(in, Seed) >> 4.
+type XXHash64Hasher struct {
+	Seed uint64
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+func (x XXHash64Hasher) Hash(in string) uint64 {
+	return xxhash64([]byte(in), x.Seed) >> 4
+}
+
+func xxhash64(b []byte, seed uint64) uint64 {
+	n := len(b)
+	var h uint64
+
+	if n >= 32 {
+		v1 := seed + xxPrime1 + xxPrime2
+		v2 := seed + xxPrime2
+		v3 := seed
+		v4 := seed - xxPrime1
+		for len(b) >= 32 {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(b[0:8]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(b[8:16]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(b[16:24]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(b[24:32]))
+			b = b[32:]
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = seed + xxPrime5
+	}
+
+	h += uint64(n)
+
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(b[:8]))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b[:4])) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for ; len(b) > 0; b = b[1:] {
+		h ^= uint64(b[0]) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	val = xxRound(0, val)
+	acc ^= val
+	return acc*xxPrime1 + xxPrime4
+}
+
+// Murmur3Hasher hashes with the x64 128-bit variant of MurmurHash3 and keeps the top
+// 60 bits of the first 64-bit half, so the same value can be computed offline as
+// murmur3_x64_128(in, Seed).h1 >> 4.
+type Murmur3Hasher struct {
+	Seed uint32
+}
+
+const (
+	murmurC1 uint64 = 0x87c37b91114253d5
+	murmurC2 uint64 = 0x4cf5ad432745937f
+)
+
+func (m Murmur3Hasher) Hash(in string) uint64 {
+	h1, _ := murmur3x64128([]byte(in), m.Seed)
+	return h1 >> 4
+}
+
+func murmur3x64128(b []byte, seed uint32) (uint64, uint64) {
+	n := len(b)
+	h1, h2 := uint64(seed), uint64(seed)
+
+	for ; len(b) >= 16; b = b[16:] {
+		k1 := binary.LittleEndian.Uint64(b[0:8])
+		k2 := binary.LittleEndian.Uint64(b[8:16])
+
+		h1 ^= murmurMixK1(k1)
+		h1 = bits.RotateLeft64(h1, 27)
+		h1 += h2
+		h1 = h1*5 + 0x52dce729
+
+		h2 ^= murmurMixK2(k2)
+		h2 = bits.RotateLeft64(h2, 31)
+		h2 += h1
+		h2 = h2*5 + 0x38495ab5
+	}
+
+	var k1, k2 uint64
+	for i := len(b) - 1; i >= 8; i-- {
+		k2 ^= uint64(b[i]) << (uint(i-8) * 8)
+	}
+	if len(b) > 8 {
+		h2 ^= murmurMixK2(k2)
+	}
+	for i := len(b) - 1; i >= 0; i-- {
+		if i < 8 {
+			k1 ^= uint64(b[i]) << (uint(i) * 8)
+		}
+	}
+	if len(b) > 0 {
+		h1 ^= murmurMixK1(k1)
+	}
+
+	h1 ^= uint64(n)
+	h2 ^= uint64(n)
+	h1 += h2
+	h2 += h1
+	h1 = murmurFmix64(h1)
+	h2 = murmurFmix64(h2)
+	h1 += h2
+	h2 += h1
+	return h1, h2
+}
+
+func murmurMixK1(k uint64) uint64 {
+	k *= murmurC1
+	k = bits.RotateLeft64(k, 31)
+	return k * murmurC2
+}
+
+func murmurMixK2(k uint64) uint64 {
+	k *= murmurC2
+	k = bits.RotateLeft64(k, 33)
+	return k * murmurC1
+}
+
+func murmurFmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
@@ -0,0 +1,104 @@
+package planout
+
+import (
+	"testing"
+)
+
+// Golden values computed with the reference implementation's
+// int(hashlib.sha1(in).hexdigest()[:15], 16). These must never change,
+// otherwise existing experiments would reassign their units.
+func TestSHA1HasherGolden(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected uint64
+	}{
+		{"", 982798738632651952},
+		{"foo.specific_goal.123454", 142434788055543052},
+		{"global_salt.a.noocavzddw", 361613306831934510},
+		{"simple_namespace.simple_namespace.test-id", 276350943495747392},
+		{"experiment_salt.x.42.3", 330886152445846346},
+		{"ünïcode.salt.user", 1035639706174699807},
+	}
+
+	for _, tt := range tests {
+		if h := (SHA1Hasher{}).Hash(tt.in); h != tt.expected {
+			t.Errorf("SHA1Hasher.Hash(%q). Expected %v. Actual %v\n", tt.in, tt.expected, h)
+		}
+		if h := hash(tt.in); h != tt.expected {
+			t.Errorf("hash(%q). Expected %v. Actual %v\n", tt.in, tt.expected, h)
+		}
+	}
+}
+
+// Reference vectors for 64-bit xxHash and 128-bit x64 MurmurHash3 with seed 0
+func TestAlternativeHashers(t *testing.T) {
+	tests := []struct {
+		in      string
+		xxhash  uint64
+		murmur3 uint64
+	}{
+		{"", 0xef46db3751d8e999, 0},
+		{"abc", 0x44bc2cf5ad770999, 0xb4963f3f3fad7867},
+		{"hello", 0x26c7827d889f6da3, 0xcbd8a7b341bd9b02},
+		{"The quick brown fox jumps over the lazy dog", 0x0b242d361fda71bc, 0xe34bbc7bbc071b6c},
+	}
+
+	for _, tt := range tests {
+		if h := xxhash64([]byte(tt.in), 0); h != tt.xxhash {
+			t.Errorf("xxhash64(%q). Expected %x. Actual %x\n", tt.in, tt.xxhash, h)
+		}
+		if h := (XXHash64Hasher{}).Hash(tt.in); h != tt.xxhash>>4 {
+			t.Errorf("XXHash64Hasher.Hash(%q). Expected %x. Actual %x\n", tt.in, tt.xxhash>>4, h)
+		}
+		if h, _ := murmur3x64128([]byte(tt.in), 0); h != tt.murmur3 {
+			t.Errorf("murmur3x64128(%q). Expected %x. Actual %x\n", tt.in, tt.murmur3, h)
+		}
+		if h := (Murmur3Hasher{}).Hash(tt.in); h != tt.murmur3>>4 {
+			t.Errorf("Murmur3Hasher.Hash(%q). Expected %x. Actual %x\n", tt.in, tt.murmur3>>4, h)
+		}
+	}
+}
+
+func TestInterpreterHasher(t *testing.T) {
+	code := []byte(`{"op":"set","var":"x","value":{"op":"randomInteger","min":0,"max":1000000,"unit":{"op":"get","var":"userid"}}}`)
+	inputs := map[string]interface{}{"userid": "test-id"}
+
+	hashers := []Hasher{nil, SHA1Hasher{}, XXHash64Hasher{}, XXHash64Hasher{Seed: 1}, Murmur3Hasher{}}
+	for _, hasher := range hashers {
+		expt, _ := runExperimentWithSalt(code, "salt", inputs)
+		expected := hasher
+		if expected == nil {
+			expected = SHA1Hasher{}
+		}
+
+		expt.Hasher = hasher
+		expt.Outputs = map[string]interface{}{}
+		if _, ok := expt.Run(); !ok {
+			t.Fatalf("Error running experiment with hasher %T\n", hasher)
+		}
+
+		x, _ := expt.Get("x")
+		if compare(x, expected.Hash("salt.x.test-id")%1000001) != 0 {
+			t.Errorf("Hasher %#v. Expected %v. Actual %v\n", hasher, expected.Hash("salt.x.test-id")%1000001, x)
+		}
+	}
+}
+
+func TestNamespaceHasher(t *testing.T) {
+	inputs := map[string]interface{}{"userid": "test-id"}
+
+	n := NewSimpleNamespace("simple_namespace", 100, "userid", inputs)
+	n.Hasher = XXHash64Hasher{}
+	e := &Interpreter{Name: "simple", Salt: "simple", Inputs: inputs, Code: readTest("test/simple.json"),
+		Outputs: map[string]interface{}{}, Overrides: map[string]interface{}{}}
+	n.AddExperiment("simple", e, 100)
+
+	expected := XXHash64Hasher{}.Hash("simple_namespace.simple_namespace.test-id") % 100
+	if seg := n.getSegment(); seg != expected {
+		t.Errorf("Segment with XXHash64Hasher. Expected %v. Actual %v\n", expected, seg)
+	}
+
+	if interpreter := n.Run(); interpreter.Hasher != n.Hasher {
+		t.Errorf("Expected the experiment to inherit the namespace hasher. Actual %#v\n", interpreter.Hasher)
+	}
+}
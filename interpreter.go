@@ -17,7 +17,14 @@
 package planout
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/biased-unit/planout-golang/compiler"
 )
 
 type PlanOutCode interface {
@@ -30,10 +37,46 @@ type Interpreter struct {
 	Inputs, Outputs, Overrides map[string]interface{}
 	Code                       interface{}
 	Evaluated, InExperiment    bool
+	Hasher                     Hasher             // used by random operators, SHA1Hasher if nil
+	Limits                     Limits             // resources a run may use, unlimited by default
+	Tracing                    bool               // record the evaluation tree returned by Trace
+	SourceMap                  compiler.SourceMap // locates the operators of Code in the script, see CompileWithSourceMap
 	parameterSalt              string
+	ctx                        context.Context
+	err                        error
+	steps, depth               int
+	trace                      *TraceNode
+	traceStack                 []*TraceNode
+	locations                  map[uintptr]*compiler.Location
+	locationStack              []locatedOp
+}
+
+// Limits bounds the work done by a single run, to protect services that load scripts
+// they do not control. A run exceeding a limit fails with an error wrapping ErrLimitExceeded.
+// Zero fields are unlimited.
+type Limits struct {
+	MaxSteps        int // operators and arrays evaluated
+	MaxDepth        int // nesting of operators and arrays
+	MaxArrayLength  int // length of the arrays in the script and of those operators return
+	MaxStringLength int // length in bytes of the strings in the script and of those operators return
+}
+
+// DefaultLimits are generous limits for scripts from untrusted sources
+var DefaultLimits = Limits{
+	MaxSteps:        100000,
+	MaxDepth:        500,
+	MaxArrayLength:  10000,
+	MaxStringLength: 1 << 20,
 }
 
 func (interpreter *Interpreter) Run(force ...bool) (map[string]interface{}, bool) {
+	return interpreter.RunContext(context.Background(), force...)
+}
+
+// RunContext is like Run, but stops evaluating the script once ctx is done. Cancellation
+// is checked before each operator, and operators that block can watch Context().
+// When the script is stopped, Err returns an *EvaluationError wrapping ctx.Err().
+func (interpreter *Interpreter) RunContext(ctx context.Context, force ...bool) (map[string]interface{}, bool) {
 
 	if len(force) > 0 && force[0] == false {
 		if interpreter.Evaluated {
@@ -41,11 +84,32 @@ func (interpreter *Interpreter) Run(force ...bool) (map[string]interface{}, bool
 		}
 	}
 
+	interpreter.err = nil
+	interpreter.ctx = ctx
+	interpreter.steps, interpreter.depth = 0, 0
+	interpreter.trace, interpreter.traceStack = nil, nil
+	interpreter.locations, interpreter.locationStack = nil, nil
+	if interpreter.SourceMap != nil {
+		interpreter.locations = map[uintptr]*compiler.Location{}
+		interpreter.indexLocations(interpreter.Code, "")
+	}
 	defer func() (map[string]interface{}, bool) {
+		interpreter.ctx = nil
 		if r := recover(); r != nil {
+			interpreter.err = recoveredError(r)
+			if n := len(interpreter.locationStack); n > 0 {
+				interpreter.err = interpreter.locationStack[n-1].locate(interpreter.err)
+			}
+			if interpreter.Tracing {
+				interpreter.failTrace(interpreter.err)
+			}
 			fmt.Println("Recovered ", r)
 			return nil, false
 		}
+		if interpreter.Tracing {
+			// a return statement stops the run from inside the operators enclosing it
+			interpreter.unwindTrace(interpreter.InExperiment)
+		}
 		interpreter.Evaluated = true
 		return interpreter.Outputs, true
 	}()
@@ -54,6 +118,21 @@ func (interpreter *Interpreter) Run(force ...bool) (map[string]interface{}, bool
 	return interpreter.Outputs, true
 }
 
+// Err returns the error that stopped the last call to Run, or nil if there was none.
+// Errors raised by operators are of type *EvaluationError.
+func (interpreter *Interpreter) Err() error {
+	return interpreter.err
+}
+
+// Context returns the context of the running script, for operators that do I/O.
+// Outside of RunContext it returns context.Background().
+func (interpreter *Interpreter) Context() context.Context {
+	if interpreter.ctx == nil {
+		return context.Background()
+	}
+	return interpreter.ctx
+}
+
 func (interpreter *Interpreter) Get(name string) (interface{}, bool) {
 	value, ok := interpreter.Overrides[name]
 	if ok {
@@ -72,6 +151,14 @@ func (interpreter *Interpreter) Get(name string) (interface{}, bool) {
 	return nil, false
 }
 
+func (interpreter *Interpreter) hash(in string) uint64 {
+	interpreter.traceHash(in)
+	if interpreter.Hasher == nil {
+		return hash(in)
+	}
+	return interpreter.Hasher.Hash(in)
+}
+
 func (interpreter *Interpreter) set(name string, value interface{}) {
 	interpreter.Outputs[name] = value
 }
@@ -91,7 +178,19 @@ func (interpreter *Interpreter) evaluate(code interface{}) interface{} {
 	if ok {
 		opptr, exists := isOperator(js)
 		if exists {
-			return opptr.execute(js, interpreter)
+			opstr := js["op"].(string)
+			location := interpreter.location(js)
+			if location != nil {
+				interpreter.locationStack = append(interpreter.locationStack, locatedOp{opstr, location})
+			}
+			interpreter.enter(opstr)
+			interpreter.startTrace(opstr, js)
+			result := opptr.execute(js, interpreter)
+			interpreter.endTrace(result)
+			if location != nil {
+				interpreter.locationStack = interpreter.locationStack[:len(interpreter.locationStack)-1]
+			}
+			return interpreter.leave(opstr, result)
 		}
 	}
 
@@ -106,12 +205,103 @@ func (interpreter *Interpreter) evaluate(code interface{}) interface{} {
 				}
 			}
 		}
+		interpreter.enter("array")
+		interpreter.checkSize("array", arr)
+		interpreter.startTrace("array", arr)
 		v := make([]interface{}, len(arr))
 		for i := range arr {
 			v[i] = interpreter.evaluate(arr[i])
 		}
-		return v
+		interpreter.endTrace(v)
+		return interpreter.leave("array", v)
 	}
 
+	interpreter.checkSize("literal", code)
 	return code
 }
+
+// enter is called before evaluating an operator or array. It stops the run when the
+// context is done or the step or depth limits are exceeded.
+func (interpreter *Interpreter) enter(opstr string) {
+	if interpreter.ctx != nil {
+		if err := interpreter.ctx.Err(); err != nil {
+			panicEvaluation(opstr, err)
+		}
+	}
+
+	interpreter.steps++
+	if max := interpreter.Limits.MaxSteps; max > 0 && interpreter.steps > max {
+		panicEvaluation(opstr, fmt.Errorf("%w: more than %d evaluation steps", ErrLimitExceeded, max))
+	}
+	interpreter.depth++
+	if max := interpreter.Limits.MaxDepth; max > 0 && interpreter.depth > max {
+		panicEvaluation(opstr, fmt.Errorf("%w: expressions nested deeper than %d", ErrLimitExceeded, max))
+	}
+}
+
+// leave is called with the result of an operator or array evaluated after enter
+func (interpreter *Interpreter) leave(opstr string, result interface{}) interface{} {
+	interpreter.depth--
+	interpreter.checkSize(opstr, result)
+	return result
+}
+
+// checkSize stops the run when value is an array or string longer than the limits
+func (interpreter *Interpreter) checkSize(opstr string, value interface{}) {
+	switch value := value.(type) {
+	case []interface{}:
+		if max := interpreter.Limits.MaxArrayLength; max > 0 && len(value) > max {
+			panicEvaluation(opstr, fmt.Errorf("%w: array of %d elements, more than %d", ErrLimitExceeded, len(value), max))
+		}
+	case string:
+		if max := interpreter.Limits.MaxStringLength; max > 0 && len(value) > max {
+			panicEvaluation(opstr, fmt.Errorf("%w: string of %d bytes, more than %d", ErrLimitExceeded, len(value), max))
+		}
+	}
+}
+
+// indexLocations finds the operators of the code in the SourceMap, by their JSON pointer
+func (interpreter *Interpreter) indexLocations(code interface{}, path string) {
+	switch code := code.(type) {
+	case map[string]interface{}:
+		if location, ok := interpreter.SourceMap[path]; ok {
+			interpreter.locations[reflect.ValueOf(code).Pointer()] = &location
+		}
+		for key, value := range code {
+			interpreter.indexLocations(value, path+"/"+pointerEscaper.Replace(key))
+		}
+	case []interface{}:
+		for i, value := range code {
+			interpreter.indexLocations(value, path+"/"+strconv.Itoa(i))
+		}
+	}
+}
+
+// location returns the location of an operator in the script, or nil if it is not in the SourceMap
+func (interpreter *Interpreter) location(code map[string]interface{}) *compiler.Location {
+	if interpreter.locations == nil {
+		return nil
+	}
+	return interpreter.locations[reflect.ValueOf(code).Pointer()]
+}
+
+// locatedOp is an operator being evaluated that is in the SourceMap
+type locatedOp struct {
+	op       string
+	location *compiler.Location
+}
+
+// locate adds the location of the operator to an error raised while evaluating it. Errors that are not
+// an *EvaluationError, such as those of operators that panic, are wrapped in one.
+func (l locatedOp) locate(err error) error {
+	var evalErr *EvaluationError
+	if !errors.As(err, &evalErr) {
+		return &EvaluationError{Op: l.op, Err: err, Location: l.location}
+	}
+	if evalErr.Location == nil {
+		evalErr.Location = l.location
+	}
+	return err
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
@@ -17,7 +17,10 @@
 package planout
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 )
 
 func TestInterpreter(t *testing.T) {
@@ -137,3 +140,157 @@ func TestInterpreterWithOverride(t *testing.T) {
 		}
 	}
 }
+
+// blockingOp stands for an operator doing I/O: it waits until the script's context is done
+type blockingOp struct{}
+
+func (s *blockingOp) execute(m map[string]interface{}, interpreter *Interpreter) interface{} {
+	select {
+	case <-interpreter.Context().Done():
+	case <-time.After(time.Second):
+	}
+	return true
+}
+
+func TestRunContext(t *testing.T) {
+	code, err := Compile(`a = 1; b = a + 1;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newInterpreter := func() *Interpreter {
+		return &Interpreter{
+			Salt:      "foo",
+			Inputs:    map[string]interface{}{},
+			Outputs:   map[string]interface{}{},
+			Overrides: map[string]interface{}{},
+			Code:      code,
+		}
+	}
+
+	expt := newInterpreter()
+	if _, ok := expt.RunContext(context.Background()); !ok {
+		t.Fatalf("Unexpected error %v\n", expt.Err())
+	}
+	if b, _ := expt.Get("b"); compare(b, 2) != 0 {
+		t.Errorf("Variable 'b'. Expected 2. Actual %v\n", b)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	expt = newInterpreter()
+	if _, ok := expt.RunContext(ctx); ok {
+		t.Errorf("Expected a cancelled context to stop the script\n")
+	}
+	var evalErr *EvaluationError
+	if !errors.As(expt.Err(), &evalErr) || !errors.Is(expt.Err(), context.Canceled) {
+		t.Errorf("Expected an EvaluationError wrapping context.Canceled. Actual %v\n", expt.Err())
+	}
+	if len(expt.Outputs) != 0 {
+		t.Errorf("Expected no operator to run. Actual outputs %v\n", expt.Outputs)
+	}
+
+	// Operators see the deadline, and the script stops at the next operator once it passes
+	ops["blockForTest"] = &blockingOp{}
+	defer delete(ops, "blockForTest")
+
+	code = map[string]interface{}{"op": "seq", "seq": []interface{}{
+		map[string]interface{}{"op": "set", "var": "a", "value": map[string]interface{}{"op": "blockForTest"}},
+		map[string]interface{}{"op": "set", "var": "b", "value": 2},
+	}}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	expt = newInterpreter()
+	start := time.Now()
+	if _, ok := expt.RunContext(ctx); ok || !errors.Is(expt.Err(), context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to stop the script. Actual %v\n", expt.Err())
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the blocking operator to return at the deadline. Took %v\n", elapsed)
+	}
+	if _, exists := expt.Get("b"); exists {
+		t.Errorf("Variable 'b'. Expected the script to stop before setting it\n")
+	}
+	if expt.Context() != context.Background() {
+		t.Errorf("Expected Context to return context.Background() after the run\n")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	nested := interface{}(true)
+	for i := 0; i < 300; i++ {
+		nested = map[string]interface{}{"op": "not", "value": nested}
+	}
+	doubled, _ := Compile(`s = "abcdefghij"; s = s + s; s = s + s; s = s + s; s = s + s;`)
+	long, _ := Compile(`a = [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12];`)
+
+	tests := []struct {
+		limits Limits
+		code   interface{}
+	}{
+		{Limits{MaxDepth: 100}, map[string]interface{}{"op": "set", "var": "x", "value": nested}},
+		{Limits{MaxSteps: 200}, map[string]interface{}{"op": "set", "var": "x", "value": nested}},
+		{Limits{MaxStringLength: 100}, doubled},
+		{Limits{MaxArrayLength: 10}, long},
+	}
+	for i, tc := range tests {
+		expt := &Interpreter{
+			Salt:      "foo",
+			Inputs:    map[string]interface{}{},
+			Outputs:   map[string]interface{}{},
+			Overrides: map[string]interface{}{},
+			Code:      tc.code,
+			Limits:    tc.limits,
+		}
+		if _, ok := expt.Run(); ok || !errors.Is(expt.Err(), ErrLimitExceeded) {
+			t.Errorf("Case %d, limits %+v. Expected ErrLimitExceeded. Actual %v\n", i, tc.limits, expt.Err())
+		}
+
+		// The same scripts run within the default limits
+		expt.Limits = DefaultLimits
+		expt.Outputs = map[string]interface{}{}
+		if _, ok := expt.Run(); !ok {
+			t.Errorf("Case %d, default limits. Unexpected error %v\n", i, expt.Err())
+		}
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	code, sourceMap, err := CompileWithSourceMap("a = 1;\nif (a > 0) {\n  b = 2 / (a - 1);\n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expt := &Interpreter{
+		Salt:      "foo",
+		Inputs:    map[string]interface{}{},
+		Outputs:   map[string]interface{}{},
+		Overrides: map[string]interface{}{},
+		Code:      code,
+		SourceMap: sourceMap,
+		Tracing:   true,
+	}
+	if _, ok := expt.Run(); ok || !errors.Is(expt.Err(), ErrDivisionByZero) {
+		t.Fatalf("Expected division by zero to fail. Actual %v\n", expt.Err())
+	}
+	if expected := "3:7: Operator Division: division by zero"; expt.Err().Error() != expected {
+		t.Errorf("Expected error %q. Actual %q\n", expected, expt.Err())
+	}
+	div := findTraceNodes(expt.Trace(), "/")
+	if len(div) != 1 || div[0].Location == nil || div[0].Location.Start.Line != 3 {
+		t.Errorf("Expected the division to be traced on line 3. Actual\n%v", expt.Trace())
+	}
+
+	// Errors of operators that panic are located as well
+	expt.Code, expt.SourceMap, _ = CompileWithSourceMap("a = [1, 2];\nb = a[2];")
+	expt.Run()
+	var evalErr *EvaluationError
+	if !errors.As(expt.Err(), &evalErr) || evalErr.Op != "index" || evalErr.Location == nil || evalErr.Location.Start.Line != 2 {
+		t.Errorf("Expected the index error on line 2. Actual %v\n", expt.Err())
+	}
+
+	// Without a source map, errors have no location
+	expt.Code, expt.SourceMap = code, nil
+	expt.Run()
+	if expected := "Operator Division: division by zero"; expt.Err().Error() != expected {
+		t.Errorf("Expected error %q. Actual %q\n", expected, expt.Err())
+	}
+}
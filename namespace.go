@@ -1,6 +1,7 @@
 package planout
 
 import (
+	"context"
 	"fmt"
 	"sort"
 )
@@ -15,6 +16,7 @@ type SimpleNamespace struct {
 	PrimaryUnit        string
 	NumSegments        int
 	Inputs             map[string]interface{}
+	Hasher             Hasher // set before adding experiments, SHA1Hasher if nil
 	segmentAllocations map[uint64]string
 	availableSegments  []int
 	currentExperiments map[string]*Interpreter
@@ -49,6 +51,11 @@ func NewSimpleNamespace(name string, numSegments int, primaryUnit string, inputs
 }
 
 func (n *SimpleNamespace) Run() *Interpreter {
+	return n.RunContext(context.Background())
+}
+
+// RunContext runs the experiment the primary unit is assigned to with Interpreter.RunContext
+func (n *SimpleNamespace) RunContext(ctx context.Context) *Interpreter {
 	interpreter := n.defaultExperiment
 
 	if name, ok := n.segmentAllocations[n.getSegment()]; ok {
@@ -57,7 +64,12 @@ func (n *SimpleNamespace) Run() *Interpreter {
 		interpreter.Salt = n.Name + "." + interpreter.Name
 	}
 
-	interpreter.Run()
+	// Experiments without their own Hasher use the namespace's
+	if interpreter.Hasher == nil {
+		interpreter.Hasher = n.Hasher
+	}
+
+	interpreter.RunContext(ctx)
 	return interpreter
 }
 
@@ -112,6 +124,7 @@ func (n *SimpleNamespace) allocateExperiment(name string, segments int) {
 		Inputs:    n.Inputs,
 		Outputs:   map[string]interface{}{},
 		Overrides: map[string]interface{}{},
+		Hasher:    n.Hasher,
 	}
 
 	// Compile Sample operator
@@ -151,6 +164,7 @@ func (n *SimpleNamespace) getSegment() uint64 {
 		Inputs:    n.Inputs,
 		Outputs:   map[string]interface{}{},
 		Overrides: map[string]interface{}{},
+		Hasher:    n.Hasher,
 	}
 
 	// Compile RandomInteger operator
@@ -160,7 +174,7 @@ func (n *SimpleNamespace) getSegment() uint64 {
 	args["max"] = n.NumSegments - 1
 	args["unit"] = n.Inputs[n.PrimaryUnit]
 	s := &randomInteger{}
-	n.selectedExperiment = s.execute(args, expt).(uint64)
+	n.selectedExperiment = uint64(s.execute(args, expt).(int64))
 	return n.selectedExperiment
 }
 
@@ -18,6 +18,7 @@ package planout
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"reflect"
 	"strings"
@@ -28,40 +29,47 @@ var ops map[string]operator
 
 func init() {
 	ops = map[string]operator{
-		"seq":             &seq{},
-		"set":             &set{},
-		"get":             &get{},
-		"array":           &array{},
-		"map":             &dict{},
-		"index":           &index{},
-		"length":          &length{},
-		"coalesce":        &coalesce{},
-		"cond":            &cond{},
-		">":               &gt{},
-		">=":              &gte{},
-		"<":               &lt{},
-		"<=":              &lte{},
-		"equals":          &eq{},
-		"and":             &and{},
-		"or":              &or{},
-		"not":             &not{},
-		"min":             &min{},
-		"max":             &max{},
-		"sum":             &sum{},
-		"product":         &mul{},
-		"negative":        &neg{},
-		"round":           &round{},
-		"%":               &mod{},
-		"/":               &div{},
-		"literal":         &literal{},
-		"uniformChoice":   &uniformChoice{},
-		"bernoulliTrial":  &bernoulliTrial{},
-		"bernoulliFilter": &bernoulliFilter{},
-		"weightedChoice":  &weightedChoice{},
-		"randomInteger":   &randomInteger{},
-		"randomFloat":     &randomFloat{},
-		"sample":          &sample{},
-		"return":          &stopPlanout{},
+		"seq":               &seq{},
+		"set":               &set{},
+		"get":               &get{},
+		"array":             &array{},
+		"map":               &dict{},
+		"index":             &index{},
+		"length":            &length{},
+		"coalesce":          &coalesce{},
+		"cond":              &cond{},
+		">":                 &gt{},
+		">=":                &gte{},
+		"<":                 &lt{},
+		"<=":                &lte{},
+		"equals":            &eq{},
+		"and":               &and{},
+		"or":                &or{},
+		"not":               &not{},
+		"min":               &min{},
+		"max":               &max{},
+		"sum":               &sum{},
+		"product":           &mul{},
+		"negative":          &neg{},
+		"round":             &round{},
+		"%":                 &mod{},
+		"/":                 &div{},
+		"literal":           &literal{},
+		"uniformChoice":     &uniformChoice{},
+		"bernoulliTrial":    &bernoulliTrial{},
+		"bernoulliFilter":   &bernoulliFilter{},
+		"weightedChoice":    &weightedChoice{},
+		"randomInteger":     &randomInteger{},
+		"randomFloat":       &randomFloat{},
+		"sample":            &sample{},
+		"shuffle":           &shuffle{},
+		"randomNormal":      &randomNormal{},
+		"randomExponential": &randomExponential{},
+		"saltedChoice":      &saltedChoice{},
+		"rollout":           &rollout{},
+		"hash":              &hashValue{},
+		"bucket":            &bucket{},
+		"return":            &stopPlanout{},
 	}
 
 	rand.Seed(time.Now().UTC().UnixNano())
@@ -103,6 +111,7 @@ func (s *set) execute(m map[string]interface{}, interpreter *Interpreter) interf
 	existOrPanic(m, []string{"var", "value"}, "Set")
 	lhs := m["var"].(string)
 	interpreter.parameterSalt = lhs
+	interpreter.traceOverride(lhs)
 	value := interpreter.evaluate(m["value"])
 	interpreter.Outputs[lhs] = value
 	return true
@@ -112,6 +121,7 @@ type get struct{}
 
 func (s *get) execute(m map[string]interface{}, interpreter *Interpreter) interface{} {
 	existOrPanic(m, []string{"var"}, "Get")
+	interpreter.traceOverride(m["var"].(string))
 	value, exists := interpreter.Get(m["var"].(string))
 	if !exists {
 		panic(fmt.Sprintf("No input for key %v\n", m["var"]))
@@ -231,20 +241,27 @@ func (s *length) execute(m map[string]interface{}, interpreter *Interpreter) int
 
 type coalesce struct{}
 
+// coalesce returns the first value that is not null, or null if there is none
 func (s *coalesce) execute(m map[string]interface{}, interpreter *Interpreter) interface{} {
 	existOrPanic(m, []string{"values"}, "Coalesce")
 
-	raw_input_values := interpreter.evaluate(m["values"]).([]interface{})
-	nvalues := len(raw_input_values)
-	ret := make([]interface{}, 0, nvalues)
+	// Literal arrays are evaluated lazily, stopping at the first non-null value
+	values, ok := m["values"].([]interface{})
+	if !ok {
+		values, ok = interpreter.evaluate(m["values"]).([]interface{})
+		if !ok {
+			panicEvaluation("Coalesce", fmt.Errorf("%w: values must be an array", ErrUnsupportedType))
+		}
+	}
 
-	for i := range raw_input_values {
-		if raw_input_values[i] != nil {
-			ret = append(ret, raw_input_values[i])
+	for i := range values {
+		value := interpreter.evaluate(values[i])
+		if !isNull(value) {
+			return value
 		}
 	}
 
-	return ret
+	return nil
 }
 
 type and struct{}
@@ -316,7 +333,8 @@ func (s *lt) execute(m map[string]interface{}, interpreter *Interpreter) interfa
 	existOrPanic(m, []string{"left", "right"}, "LessThan")
 	lhs := interpreter.evaluate(m["left"])
 	rhs := interpreter.evaluate(m["right"])
-	return compare(lhs, rhs) < 0
+	ret, ok := compareOrdered(lhs, rhs, "LessThan")
+	return ok && ret < 0
 }
 
 type lte struct{}
@@ -325,7 +343,8 @@ func (s *lte) execute(m map[string]interface{}, interpreter *Interpreter) interf
 	existOrPanic(m, []string{"left", "right"}, "LessThanEqual")
 	lhs := interpreter.evaluate(m["left"])
 	rhs := interpreter.evaluate(m["right"])
-	return compare(lhs, rhs) <= 0
+	ret, ok := compareOrdered(lhs, rhs, "LessThanEqual")
+	return ok && ret <= 0
 }
 
 type gt struct{}
@@ -334,7 +353,8 @@ func (s *gt) execute(m map[string]interface{}, interpreter *Interpreter) interfa
 	existOrPanic(m, []string{"left", "right"}, "GreaterThan")
 	lhs := interpreter.evaluate(m["left"])
 	rhs := interpreter.evaluate(m["right"])
-	return compare(lhs, rhs) > 0
+	ret, ok := compareOrdered(lhs, rhs, "GreaterThan")
+	return ok && ret > 0
 }
 
 type gte struct{}
@@ -343,7 +363,8 @@ func (s *gte) execute(m map[string]interface{}, interpreter *Interpreter) interf
 	existOrPanic(m, []string{"left", "right"}, "GreaterThanEqual")
 	lhs := interpreter.evaluate(m["left"])
 	rhs := interpreter.evaluate(m["right"])
-	return compare(lhs, rhs) >= 0
+	ret, ok := compareOrdered(lhs, rhs, "GreaterThanEqual")
+	return ok && ret >= 0
 }
 
 type eq struct{}
@@ -352,7 +373,7 @@ func (s *eq) execute(m map[string]interface{}, interpreter *Interpreter) interfa
 	existOrPanic(m, []string{"left", "right"}, "Equality")
 	lhs := interpreter.evaluate(m["left"])
 	rhs := interpreter.evaluate(m["right"])
-	return compare(lhs, rhs) == 0
+	return isEqual(lhs, rhs)
 }
 
 type min struct{}
@@ -410,8 +431,7 @@ type neg struct{}
 func (s *neg) execute(m map[string]interface{}, interpreter *Interpreter) interface{} {
 	existOrPanic(m, []string{"value"}, "Negative")
 	value := interpreter.evaluate(m["value"])
-	values := []interface{}{-1.0, value}
-	return multiplySlice(values)
+	return multiply(int64(-1), value)
 }
 
 type round struct{}
@@ -428,24 +448,57 @@ func (s *round) execute(m map[string]interface{}, interpreter *Interpreter) inte
 
 type mod struct{}
 
+// mod follows Python semantics: the result takes the sign of the divisor
 func (s *mod) execute(m map[string]interface{}, interpreter *Interpreter) interface{} {
 	existOrPanic(m, []string{"left", "right"}, "Modulo")
-	var ret int64 = 0
-	lhs, _ := toNumber(interpreter.evaluate(m["left"]))
-	rhs, _ := toNumber(interpreter.evaluate(m["right"]))
-	ret = int64(lhs) % int64(rhs)
-	return float64(ret)
+	left := interpreter.evaluate(m["left"])
+	right := interpreter.evaluate(m["right"])
+
+	lhs_int, lhs_ok := toInteger(left)
+	rhs_int, rhs_ok := toInteger(right)
+	if lhs_ok && rhs_ok {
+		if rhs_int == 0 {
+			panicEvaluation("Modulo", ErrDivisionByZero)
+		}
+		ret := lhs_int % rhs_int
+		if ret != 0 && (ret < 0) != (rhs_int < 0) {
+			ret = ret + rhs_int
+		}
+		return ret
+	}
+
+	lhs, lhs_ok := toNumber(left)
+	rhs, rhs_ok := toNumber(right)
+	if !lhs_ok || !rhs_ok {
+		panicEvaluation("Modulo", fmt.Errorf("%w: %v %% %v", ErrUnsupportedType, left, right))
+	}
+	if rhs == 0 {
+		panicEvaluation("Modulo", ErrDivisionByZero)
+	}
+	ret := math.Mod(lhs, rhs)
+	if ret != 0 && (ret < 0) != (rhs < 0) {
+		ret = ret + rhs
+	}
+	return ret
 }
 
 type div struct{}
 
+// div always returns a float, as true division does in the reference implementation
 func (s *div) execute(m map[string]interface{}, interpreter *Interpreter) interface{} {
 	existOrPanic(m, []string{"left", "right"}, "Division")
-	var ret float64 = 0
-	lhs := interpreter.evaluate(m["left"]).(float64)
-	rhs := interpreter.evaluate(m["right"]).(float64)
-	ret = lhs / rhs
-	return ret
+	left := interpreter.evaluate(m["left"])
+	right := interpreter.evaluate(m["right"])
+
+	lhs, lhs_ok := toNumber(left)
+	rhs, rhs_ok := toNumber(right)
+	if !lhs_ok || !rhs_ok {
+		panicEvaluation("Division", fmt.Errorf("%w: %v / %v", ErrUnsupportedType, left, right))
+	}
+	if rhs == 0 {
+		panicEvaluation("Division", ErrDivisionByZero)
+	}
+	return lhs / rhs
 }
 
 type literal struct{}
@@ -461,5 +514,7 @@ func (s *stopPlanout) execute(m map[string]interface{}, interpreter *Interpreter
 	existOrPanic(m, []string{"value"}, "Literal")
 	value := interpreter.evaluate(m["value"])
 	interpreter.InExperiment = isTrue(value)
+	// the run unwinds past the end of the operator, so its trace is finished here
+	interpreter.endTrace(interpreter.InExperiment)
 	panic(nil)
 }
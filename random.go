@@ -19,6 +19,7 @@ package planout
 import (
 	"crypto/sha1"
 	"fmt"
+	"math"
 	"strconv"
 )
 
@@ -82,7 +83,7 @@ func getHash(args map[string]interface{}, interpreter *Interpreter, appended_uni
 		}
 	}
 
-	return hash(name)
+	return interpreter.hash(name)
 }
 
 func getUniform(args map[string]interface{}, interpreter *Interpreter, min, max float64, appended_units ...string) float64 {
@@ -119,7 +120,7 @@ type bernoulliTrial struct{}
 
 func (s *bernoulliTrial) execute(args map[string]interface{}, interpreter *Interpreter) interface{} {
 	existOrPanic(args, []string{"unit"}, "BernoulliTrial")
-	pvalue := interpreter.evaluate(args["p"]).(float64)
+	pvalue, _ := toNumber(interpreter.evaluate(args["p"]))
 	rand_val := getUniform(args, interpreter, 0.0, 1.0)
 	if rand_val <= pvalue {
 		return 1
@@ -131,7 +132,7 @@ type bernoulliFilter struct{}
 
 func (s *bernoulliFilter) execute(args map[string]interface{}, interpreter *Interpreter) interface{} {
 	existOrPanic(args, []string{"choices", "unit"}, "BernoulliFilter")
-	pvalue := interpreter.evaluate(args["p"]).(float64)
+	pvalue, _ := toNumber(interpreter.evaluate(args["p"]))
 	choices := interpreter.evaluate(args["choices"]).([]interface{})
 	ret := make([]interface{}, 0, len(choices))
 	for i := range choices {
@@ -148,16 +149,30 @@ type weightedChoice struct{}
 
 func (s *weightedChoice) execute(args map[string]interface{}, interpreter *Interpreter) interface{} {
 	existOrPanic(args, []string{"choices", "unit", "weights"}, "WeightedChoice")
-	weights := interpreter.evaluate(args["weights"]).([]interface{})
-	sum, cweights := getCummulativeWeights(weights)
+	weights, ok := toList(interpreter.evaluate(args["weights"]))
+	if !ok {
+		panicEvaluation("WeightedChoice", fmt.Errorf("%w: weights must be an array", ErrUnsupportedType))
+	}
+	choices, ok := toList(interpreter.evaluate(args["choices"]))
+	if !ok {
+		panicEvaluation("WeightedChoice", fmt.Errorf("%w: choices must be an array", ErrUnsupportedType))
+	}
+	if len(choices) != len(weights) {
+		panicEvaluation("WeightedChoice", fmt.Errorf("%w: %d choices but %d weights", ErrInvalidArgument, len(choices), len(weights)))
+	}
+	sum, cweights, err := getCummulativeWeights(weights)
+	if err != nil {
+		panicEvaluation("WeightedChoice", err)
+	}
+
 	stop_val := getUniform(args, interpreter, 0.0, sum)
-	choices := interpreter.evaluate(args["choices"]).([]interface{})
 	for i := range cweights {
 		if stop_val <= cweights[i] {
 			return choices[i]
 		}
 	}
-	return 0.0
+	// Not reached, since stop_val is at most sum, the last cumulative weight
+	return choices[len(choices)-1]
 }
 
 type randomFloat struct{}
@@ -171,30 +186,231 @@ func (s *randomFloat) execute(args map[string]interface{}, interpreter *Interpre
 
 type randomInteger struct{}
 
+// randomInteger returns an int64 in [min, max]. The size of the range is computed
+// with unsigned arithmetic so that ranges wider than math.MaxInt64 do not overflow.
 func (s *randomInteger) execute(args map[string]interface{}, interpreter *Interpreter) interface{} {
 	existOrPanic(args, []string{"unit"}, "RandomInteger")
-	min_val, _ := toNumber(getOrElse(args, "min", 0.0))
-	max_val, _ := toNumber(getOrElse(args, "max", 0.0))
+	min_val, ok := asInteger(interpreter.evaluate(getOrElse(args, "min", 0)))
+	if !ok {
+		panicEvaluation("RandomInteger", fmt.Errorf("%w: min must be an integer, got %v", ErrInvalidArgument, args["min"]))
+	}
+	max_val, ok := asInteger(interpreter.evaluate(getOrElse(args, "max", 0)))
+	if !ok {
+		panicEvaluation("RandomInteger", fmt.Errorf("%w: max must be an integer, got %v", ErrInvalidArgument, args["max"]))
+	}
+	if min_val > max_val {
+		panicEvaluation("RandomInteger", fmt.Errorf("%w: min %d is greater than max %d", ErrInvalidArgument, min_val, max_val))
+	}
+
+	h := getHash(args, interpreter)
 	mod_val := uint64(max_val) - uint64(min_val) + 1
-	return uint64(min_val) + getHash(args, interpreter)%mod_val
+	if mod_val != 0 {
+		h = h % mod_val
+	}
+	return int64(uint64(min_val) + h)
 }
 
 type sample struct{}
 
+// sample draws without replacement with a Fisher-Yates shuffle of a copy of the choices,
+// hashing each position separately as the reference PlanOut implementation does.
+// When draws exceeds the number of choices, all the shuffled choices are returned.
 func (s *sample) execute(args map[string]interface{}, interpreter *Interpreter) interface{} {
 	existOrPanic(args, []string{"choices"}, "Sample")
-	choices := interpreter.evaluate(args["choices"]).([]interface{})
-	nhash := getHash(args, interpreter)
-	FisherYatesShuffle(choices, nhash)
+	choices := shuffleChoices(args, interpreter, "Sample")
 
 	draws := len(choices)
 	arg_draws, exists := args["draws"]
 	if exists {
-		eval_draws, ok := toNumber(interpreter.evaluate(arg_draws))
-		if ok {
+		eval_draws, ok := asInteger(interpreter.evaluate(arg_draws))
+		if !ok || eval_draws < 0 {
+			panicEvaluation("Sample", fmt.Errorf("%w: draws must be a non-negative integer, got %v", ErrInvalidArgument, arg_draws))
+		}
+		if eval_draws < int64(draws) {
 			draws = int(eval_draws)
 		}
 	}
 
 	return choices[:draws]
 }
+
+// shuffleChoices returns a shuffled copy of the evaluated "choices" argument
+func shuffleChoices(args map[string]interface{}, interpreter *Interpreter, opstr string) []interface{} {
+	evaluated, ok := toList(interpreter.evaluate(args["choices"]))
+	if !ok {
+		panicEvaluation(opstr, fmt.Errorf("%w: choices must be an array", ErrUnsupportedType))
+	}
+
+	choices := make([]interface{}, len(evaluated))
+	copy(choices, evaluated)
+	for i := len(choices) - 1; i > 0; i-- {
+		j := getHash(args, interpreter, strconv.Itoa(i)) % uint64(i+1)
+		choices[i], choices[j] = choices[j], choices[i]
+	}
+	return choices
+}
+
+type shuffle struct{}
+
+// shuffle returns all the choices in a random order, like a sample without draws
+func (s *shuffle) execute(args map[string]interface{}, interpreter *Interpreter) interface{} {
+	existOrPanic(args, []string{"choices", "unit"}, "Shuffle")
+	return shuffleChoices(args, interpreter, "Shuffle")
+}
+
+// getNumberArg evaluates an optional numeric argument
+func getNumberArg(args map[string]interface{}, interpreter *Interpreter, key string, def float64, opstr string) float64 {
+	raw, exists := args[key]
+	if !exists {
+		return def
+	}
+	value, ok := toNumber(interpreter.evaluate(raw))
+	if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+		panicEvaluation(opstr, fmt.Errorf("%w: %s must be a finite number, got %v", ErrInvalidArgument, key, raw))
+	}
+	return value
+}
+
+// Smallest distance of the uniform draws of randomNormal and randomExponential from 0 and 1,
+// so that the hashes 0 and 0xFFFFFFFFFFFFFFF map to finite values.
+const uniformEpsilon = 1.0 / (1 << 53)
+
+// getOpenUniform draws a uniform number in the open interval (0, 1)
+func getOpenUniform(args map[string]interface{}, interpreter *Interpreter) float64 {
+	u := getUniform(args, interpreter, 0.0, 1.0)
+	return math.Min(math.Max(u, uniformEpsilon), 1-uniformEpsilon)
+}
+
+type randomNormal struct{}
+
+// randomNormal draws from a normal distribution by inverting its CDF at a uniform draw
+func (s *randomNormal) execute(args map[string]interface{}, interpreter *Interpreter) interface{} {
+	existOrPanic(args, []string{"unit"}, "RandomNormal")
+	mean := getNumberArg(args, interpreter, "mean", 0.0, "RandomNormal")
+	sd := getNumberArg(args, interpreter, "sd", 1.0, "RandomNormal")
+	if sd < 0 {
+		panicEvaluation("RandomNormal", fmt.Errorf("%w: sd must not be negative, got %v", ErrInvalidArgument, sd))
+	}
+	u := getOpenUniform(args, interpreter)
+	return mean + sd*math.Sqrt2*math.Erfinv(2*u-1)
+}
+
+type randomExponential struct{}
+
+// randomExponential draws from an exponential distribution by inverting its CDF at a uniform draw
+func (s *randomExponential) execute(args map[string]interface{}, interpreter *Interpreter) interface{} {
+	existOrPanic(args, []string{"unit"}, "RandomExponential")
+	rate := getNumberArg(args, interpreter, "rate", 1.0, "RandomExponential")
+	if rate <= 0 {
+		panicEvaluation("RandomExponential", fmt.Errorf("%w: rate must be positive, got %v", ErrInvalidArgument, rate))
+	}
+	u := getOpenUniform(args, interpreter)
+	return -math.Log(1-u) / rate
+}
+
+type saltedChoice struct{}
+
+// saltedChoice is a weightedChoice, with weights defaulting to equal, whose hash is salted
+// with the value of "strata". Each stratum is randomized independently of the others and is
+// split in the given proportions on average, but nothing balances the assignments within a
+// stratum: its split varies like that of any other random choice.
+func (s *saltedChoice) execute(args map[string]interface{}, interpreter *Interpreter) interface{} {
+	existOrPanic(args, []string{"choices", "strata", "unit"}, "SaltedChoice")
+	choices, ok := toList(interpreter.evaluate(args["choices"]))
+	if !ok || len(choices) == 0 {
+		panicEvaluation("SaltedChoice", fmt.Errorf("%w: choices must be a non-empty array", ErrInvalidArgument))
+	}
+
+	weights := make([]interface{}, len(choices))
+	if raw, exists := args["weights"]; exists {
+		weights, ok = toList(interpreter.evaluate(raw))
+		if !ok {
+			panicEvaluation("SaltedChoice", fmt.Errorf("%w: weights must be an array", ErrUnsupportedType))
+		}
+		if len(choices) != len(weights) {
+			panicEvaluation("SaltedChoice", fmt.Errorf("%w: %d choices but %d weights", ErrInvalidArgument, len(choices), len(weights)))
+		}
+	} else {
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	sum, cweights, err := getCummulativeWeights(weights)
+	if err != nil {
+		panicEvaluation("SaltedChoice", err)
+	}
+
+	stratum := generateUnitStr(interpreter.evaluate(args["strata"]))
+	stop_val := getUniform(args, interpreter, 0.0, sum, stratum)
+	for i := range cweights {
+		if stop_val <= cweights[i] {
+			return choices[i]
+		}
+	}
+	// Not reached, since stop_val is at most sum, the last cumulative weight
+	return choices[len(choices)-1]
+}
+
+type rollout struct{}
+
+// rollout includes the first percent of the units, returning 1 for included units and 0
+// otherwise. Each unit has a fixed position in [0, 100) given by its hash, and is included
+// when its position is below percent, so raising percent never excludes a unit again.
+// The "salt" argument names the rollout and is used as a full salt: it is not combined with
+// the experiment salt, so the same units stay included when the experiment salt changes.
+func (s *rollout) execute(args map[string]interface{}, interpreter *Interpreter) interface{} {
+	existOrPanic(args, []string{"percent", "unit"}, "Rollout")
+	percent, ok := toNumber(interpreter.evaluate(args["percent"]))
+	if !ok || !(percent >= 0 && percent <= 100) {
+		panicEvaluation("Rollout", fmt.Errorf("%w: percent must be a number between 0 and 100, got %v", ErrInvalidArgument, args["percent"]))
+	}
+
+	hashArgs := args
+	if rawSalt, exists := args["salt"]; exists {
+		if _, exists := args["full_salt"]; !exists {
+			salt, _ := toString(interpreter.evaluate(rawSalt))
+			hashArgs = map[string]interface{}{"unit": args["unit"], "full_salt": salt}
+		}
+	}
+
+	scale, _ := strconv.ParseUint("FFFFFFFFFFFFFFF", 16, 64)
+	position := float64(getHash(hashArgs, interpreter)) / (float64(scale) + 1) * 100
+	// The largest hashes round up to a position of 100
+	if position < percent || percent == 100 {
+		return 1
+	}
+	return 0
+}
+
+// getHashedValue hashes the "value" argument, prefixed by the optional "salt" argument,
+// in the same way the random operators hash their unit with a full_salt.
+func getHashedValue(args map[string]interface{}, interpreter *Interpreter) uint64 {
+	name := generateUnitStr(interpreter.evaluate(args["value"]))
+	if rawSalt, exists := args["salt"]; exists {
+		salt, _ := toString(interpreter.evaluate(rawSalt))
+		name = generateNameToHash(name, salt)
+	}
+	return interpreter.hash(name)
+}
+
+type hashValue struct{}
+
+// hashValue returns the 60-bit hash of a value, computed by the interpreter's Hasher.
+// Unlike the random operators, the experiment and parameter salts are not mixed in, so
+// the same value and salt give the same hash in every experiment.
+func (s *hashValue) execute(args map[string]interface{}, interpreter *Interpreter) interface{} {
+	existOrPanic(args, []string{"value"}, "Hash")
+	return int64(getHashedValue(args, interpreter))
+}
+
+type bucket struct{}
+
+// bucket maps a value to one of n buckets, numbered from 0, using the hash operator
+func (s *bucket) execute(args map[string]interface{}, interpreter *Interpreter) interface{} {
+	existOrPanic(args, []string{"value", "n"}, "Bucket")
+	n, ok := asInteger(interpreter.evaluate(args["n"]))
+	if !ok || n <= 0 {
+		panicEvaluation("Bucket", fmt.Errorf("%w: n must be a positive integer, got %v", ErrInvalidArgument, args["n"]))
+	}
+	return int64(getHashedValue(args, interpreter) % uint64(n))
+}
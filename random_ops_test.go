@@ -19,6 +19,7 @@ package planout
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
@@ -325,6 +326,41 @@ func TestWeightedChoice(t *testing.T) {
 	}
 }
 
+func TestWeightedChoiceArguments(t *testing.T) {
+	inputs := map[string]interface{}{
+		"userid":  generateString(),
+		"choices": []string{"a", "b", "c"},
+		"weights": []int{0, 3, 0},
+	}
+
+	expt, ok := runExperimentWithSalt([]byte(`{"op":"set","var":"x",
+	"value":{"op":"weightedChoice","choices":{"op":"get","var":"choices"},"weights":{"op":"get","var":"weights"},"unit":{"op":"get","var":"userid"}}}`),
+		"experiment_salt", inputs)
+	if x, _ := expt.Get("x"); !ok || x != "b" {
+		t.Errorf("Variable 'x'. Expected b. Actual %v (%v)\n", x, expt.Err())
+	}
+
+	invalid := []struct {
+		choices, weights string
+		err              error
+	}{
+		{`["a","b"]`, `[1,2,3]`, ErrInvalidArgument},
+		{`["a","b"]`, `[0,0]`, ErrInvalidArgument},
+		{`["a","b"]`, `[-1,2]`, ErrInvalidArgument},
+		{`[]`, `[]`, ErrInvalidArgument},
+		{`["a","b"]`, `[1,"x"]`, ErrUnsupportedType},
+		{`["a","b"]`, `3`, ErrUnsupportedType},
+	}
+	for _, tc := range invalid {
+		expt, ok := runExperimentWithSalt([]byte(`{"op":"set","var":"x",
+		"value":{"op":"weightedChoice","choices":`+tc.choices+`,"weights":`+tc.weights+`,"unit":{"op":"get","var":"userid"}}}`),
+			"experiment_salt", inputs)
+		if ok || !errors.Is(expt.Err(), tc.err) {
+			t.Errorf("WeightedChoice(%v, %v). Expected %v. Actual %v\n", tc.choices, tc.weights, tc.err, expt.Err())
+		}
+	}
+}
+
 func TestSampling(t *testing.T) {
 	var textTemplate string = `{"op":"seq",
 	"seq":[{"op":"set","var":"x",
@@ -346,3 +382,249 @@ func TestSampling(t *testing.T) {
 		}
 	}
 }
+
+func TestSampleArguments(t *testing.T) {
+	choices := []interface{}{1, 2, 3, 4, 5}
+	inputs := map[string]interface{}{"userid": generateString(), "choices": choices}
+
+	expt, ok := runExperimentWithSalt([]byte(`{"op":"seq",
+	"seq":[{"op":"set","var":"x","value":{"op":"sample","choices":{"op":"get","var":"choices"},"salt":"s","unit":{"op":"get","var":"userid"}}},
+		{"op":"set","var":"y","value":{"op":"sample","choices":{"op":"get","var":"choices"},"draws":10,"salt":"s","unit":{"op":"get","var":"userid"}}}]}`),
+		"experiment_salt", inputs)
+	if !ok {
+		t.Fatalf("Sample. Unexpected error %v\n", expt.Err())
+	}
+
+	// The input array is not shuffled in place
+	if !reflect.DeepEqual(choices, []interface{}{1, 2, 3, 4, 5}) {
+		t.Errorf("Sample. Expected the input choices to be unchanged. Actual %v\n", choices)
+	}
+
+	x, _ := expt.Get("x")
+	y, _ := expt.Get("y")
+	if !reflect.DeepEqual(x, y) {
+		t.Errorf("Variable 'y'. Expected all %v choices when draws exceeds their number. Actual %v\n", x, y)
+	}
+
+	for _, draws := range []string{`-1`, `1.5`, `"a"`} {
+		expt, ok := runExperimentWithSalt([]byte(`{"op":"set","var":"x",
+		"value":{"op":"sample","choices":[1,2,3],"draws":`+draws+`,"unit":{"op":"get","var":"userid"}}}`),
+			"experiment_salt", inputs)
+		if ok || !errors.Is(expt.Err(), ErrInvalidArgument) {
+			t.Errorf("Sample with draws=%v. Expected ErrInvalidArgument. Actual %v\n", draws, expt.Err())
+		}
+	}
+}
+
+func TestRandomIntegerRange(t *testing.T) {
+	inputs := map[string]interface{}{"userid": generateString()}
+	code := `{"op":"set","var":"x","value":{"op":"randomInteger","min":%v,"max":%v,"unit":{"op":"get","var":"userid"}}}`
+
+	ranges := []struct{ min, max int64 }{{-5, 5}, {-10, -10}, {math.MinInt64, math.MaxInt64}, {math.MaxInt64 - 1, math.MaxInt64}}
+	for _, r := range ranges {
+		// Decode keeps integers beyond 2^53 exact
+		decoded, _ := Decode([]byte(fmt.Sprintf(code, r.min, r.max)))
+		expt := &Interpreter{
+			Salt:      "experiment_salt",
+			Inputs:    inputs,
+			Outputs:   map[string]interface{}{},
+			Overrides: map[string]interface{}{},
+			Code:      decoded,
+		}
+		if _, ok := expt.Run(); !ok {
+			t.Errorf("RandomInteger(%v, %v). Unexpected error %v\n", r.min, r.max, expt.Err())
+			continue
+		}
+		x, _ := expt.Get("x")
+		i, isInt := x.(int64)
+		if !isInt || i < r.min || i > r.max {
+			t.Errorf("RandomInteger(%v, %v). Expected an int64 in range. Actual %v (%T)\n", r.min, r.max, x, x)
+		}
+	}
+
+	for _, args := range [][2]string{{`5`, `-5`}, {`0.5`, `10`}, {`0`, `"a"`}} {
+		expt, ok := runExperimentWithSalt([]byte(fmt.Sprintf(code, args[0], args[1])), "experiment_salt", inputs)
+		if ok || !errors.Is(expt.Err(), ErrInvalidArgument) {
+			t.Errorf("RandomInteger(%v, %v). Expected ErrInvalidArgument. Actual %v\n", args[0], args[1], expt.Err())
+		}
+	}
+}
+
+func TestDistributionOperators(t *testing.T) {
+	code, err := Compile(`
+		n = randomNormal(mean=10, sd=2, unit=userid);
+		e = randomExponential(rate=4, unit=userid);
+		s = shuffle(choices=[1, 2, 3, 4], unit=userid);
+		c = saltedChoice(choices=["a", "b", "c"], weights=[2, 1, 1], strata=country, unit=userid);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs := 2000
+	var nsum, nsquares, esum float64
+	strata := map[string]Histogram{"us": {hist: map[string]int{}}, "fr": {hist: map[string]int{}}}
+	for i := 0; i < runs; i++ {
+		country := "us"
+		if i%2 == 1 {
+			country = "fr"
+		}
+		expt := &Interpreter{
+			Salt:      "experiment_salt",
+			Inputs:    map[string]interface{}{"userid": generateString(), "country": country},
+			Outputs:   map[string]interface{}{},
+			Overrides: map[string]interface{}{},
+			Code:      code,
+		}
+		if _, ok := expt.Run(); !ok {
+			t.Fatalf("Unexpected error %v\n", expt.Err())
+		}
+
+		n, _ := expt.Get("n")
+		nsum += n.(float64)
+		nsquares += n.(float64) * n.(float64)
+		e, _ := expt.Get("e")
+		if e.(float64) < 0 {
+			t.Errorf("Variable 'e'. Expected a non-negative value. Actual %v\n", e)
+		}
+		esum += e.(float64)
+
+		s, _ := expt.Get("s")
+		if len(s.([]interface{})) != 4 || compare(addSlice(s.([]interface{})), 10) != 0 {
+			t.Errorf("Variable 's'. Expected a permutation of [1 2 3 4]. Actual %v\n", s)
+		}
+
+		c, _ := expt.Get("c")
+		strata[country].add(c)
+	}
+
+	mean := nsum / float64(runs)
+	sd := math.Sqrt(nsquares/float64(runs) - mean*mean)
+	if math.Abs(mean-10) > 0.2 || math.Abs(sd-2) > 0.2 {
+		t.Errorf("RandomNormal. Expected mean 10 and sd 2. Actual mean %v and sd %v\n", mean, sd)
+	}
+	if emean := esum / float64(runs); math.Abs(emean-0.25) > 0.03 {
+		t.Errorf("RandomExponential. Expected mean 0.25. Actual %v\n", emean)
+	}
+	expected := map[string]float64{"a": 0.5, "b": 0.25, "c": 0.25}
+	for country, h := range strata {
+		if !h.passed(expected) {
+			t.Errorf("SaltedChoice in stratum %v. Expected %v. Actual %v\n", country, expected, h)
+		}
+	}
+
+	invalid := []string{
+		`{"op":"randomNormal","sd":-1,"unit":"u"}`,
+		`{"op":"randomExponential","rate":0,"unit":"u"}`,
+		`{"op":"saltedChoice","choices":[],"strata":"us","unit":"u"}`,
+		`{"op":"saltedChoice","choices":["a"],"weights":[1,2],"strata":"us","unit":"u"}`,
+	}
+	for _, value := range invalid {
+		expt, ok := runExperiment([]byte(`{"op":"set","var":"x","value":` + value + `}`))
+		if ok || !errors.Is(expt.Err(), ErrInvalidArgument) {
+			t.Errorf("%v. Expected ErrInvalidArgument. Actual %v\n", value, expt.Err())
+		}
+	}
+}
+
+func TestRollout(t *testing.T) {
+	code := `{"op":"set","var":"x","value":{"op":"rollout","percent":%v,"salt":"new_feature","unit":{"op":"get","var":"userid"}}}`
+
+	units := make([]string, 2000)
+	for i := range units {
+		units[i] = generateString()
+	}
+
+	included := map[string]bool{}
+	for _, percent := range []float64{0, 0.5, 1, 5, 10, 10.5, 20, 50, 75, 99.9, 100} {
+		count := 0
+		for _, unit := range units {
+			expt, ok := runExperimentWithSalt([]byte(fmt.Sprintf(code, percent)), "experiment_salt", map[string]interface{}{"userid": unit})
+			if !ok {
+				t.Fatalf("Rollout(%v). Unexpected error %v\n", percent, expt.Err())
+			}
+			x, _ := expt.Get("x")
+			if x == 1 {
+				included[unit] = true
+				count++
+			} else if included[unit] {
+				t.Errorf("Rollout(%v). Unit %v was included at a lower percentage and dropped out\n", percent, unit)
+			}
+		}
+		if percent == 0 && count != 0 || percent == 100 && count != len(units) {
+			t.Errorf("Rollout(%v). Expected %v%% of the units. Actual %v of %v\n", percent, percent, count, len(units))
+		}
+		if actual := 100 * float64(count) / float64(len(units)); math.Abs(actual-percent) > 4 {
+			t.Errorf("Rollout(%v). Expected about %v%% of the units. Actual %v%%\n", percent, percent, actual)
+		}
+	}
+
+	// The rollout salt is not combined with the experiment salt
+	for _, unit := range units[:100] {
+		inputs := map[string]interface{}{"userid": unit}
+		expt, _ := runExperimentWithSalt([]byte(fmt.Sprintf(code, 30)), "experiment_salt", inputs)
+		other, _ := runExperimentWithSalt([]byte(fmt.Sprintf(code, 30)), "another_salt", inputs)
+		x, _ := expt.Get("x")
+		y, _ := other.Get("x")
+		if x != y {
+			t.Errorf("Rollout for %v. Expected the same inclusion with another experiment salt. Actual %v and %v\n", unit, x, y)
+		}
+	}
+
+	for _, percent := range []string{`-1`, `100.5`, `"a"`} {
+		expt, ok := runExperimentWithSalt([]byte(fmt.Sprintf(code, percent)), "experiment_salt", map[string]interface{}{"userid": "u"})
+		if ok || !errors.Is(expt.Err(), ErrInvalidArgument) {
+			t.Errorf("Rollout(%v). Expected ErrInvalidArgument. Actual %v\n", percent, expt.Err())
+		}
+	}
+}
+
+func TestHashOperators(t *testing.T) {
+	unit := generateString()
+	inputs := map[string]interface{}{"userid": unit}
+
+	expt, _ := runExperimentWithSalt([]byte(`{"op":"seq",
+	"seq":[{"op":"set","var":"h","value":{"op":"hash","value":{"op":"get","var":"userid"},"salt":"holdout"}},
+		{"op":"set","var":"b","value":{"op":"bucket","value":{"op":"get","var":"userid"},"salt":"holdout","n":100}},
+		{"op":"set","var":"c","value":{"op":"uniformChoice","choices":[0,1,2,3,4,5,6],"unit":{"op":"get","var":"userid"},"full_salt":"holdout"}},
+		{"op":"set","var":"u","value":{"op":"hash","value":[{"op":"get","var":"userid"},42]}}]}`),
+		"experiment_salt", inputs)
+
+	h, _ := expt.Get("h")
+	if h != int64(hash("holdout."+unit)) {
+		t.Errorf("Variable 'h'. Expected %v. Actual %v\n", hash("holdout."+unit), h)
+	}
+
+	b, _ := expt.Get("b")
+	if b != int64(hash("holdout."+unit)%100) {
+		t.Errorf("Variable 'b'. Expected %v. Actual %v\n", hash("holdout."+unit)%100, b)
+	}
+
+	// The hash matches the one used by random operators with the same full salt
+	c, _ := expt.Get("c")
+	if compare(c, h.(int64)%7) != 0 {
+		t.Errorf("Variable 'c'. Expected %v. Actual %v\n", h.(int64)%7, c)
+	}
+
+	u, _ := expt.Get("u")
+	if u != int64(hash(unit+".42")) {
+		t.Errorf("Variable 'u'. Expected %v. Actual %v\n", hash(unit+".42"), u)
+	}
+
+	// The experiment salt is not mixed in
+	other, _ := runExperimentWithSalt([]byte(`{"op":"set","var":"h",
+	"value":{"op":"hash","value":{"op":"get","var":"userid"},"salt":"holdout"}}`),
+		"another_salt", inputs)
+	if x, _ := other.Get("h"); x != h {
+		t.Errorf("Variable 'h'. Expected the same hash in every experiment. Actual %v and %v\n", h, x)
+	}
+
+	for _, n := range []string{`0`, `-3`, `"a"`} {
+		expt, ok := runExperimentWithSalt([]byte(`{"op":"set","var":"b",
+		"value":{"op":"bucket","value":{"op":"get","var":"userid"},"n":`+n+`}}`),
+			"experiment_salt", inputs)
+		if ok || !errors.Is(expt.Err(), ErrInvalidArgument) {
+			t.Errorf("Bucket with n=%v. Expected ErrInvalidArgument. Actual %v\n", n, expt.Err())
+		}
+	}
+}
@@ -0,0 +1,49 @@
+#!/usr/bin/env python
+"""Regenerates the expected outputs of the reference vectors in this directory.
+
+Each vector file holds a PlanOut script, its compiled code, the experiment salt
+and a list of cases. For every case this script runs the code with the reference
+Python implementation and rewrites the expected outputs:
+
+    pip install planout==0.6.0
+    python test/vectors/generate.py test/vectors/*.json
+
+The implementation the outputs come from is recorded in the "source" field of
+each vector, and the script refuses to run with another version than the one
+TestReferenceVectors expects there.
+
+To add a vector, write a new file with "script", "code", "salt" and the "inputs"
+of each case, then run this script to fill in the "outputs".
+"""
+import copy
+import json
+import sys
+
+import pkg_resources
+from planout.interpreter import Interpreter
+
+REFERENCE_VERSION = '0.6.0'
+
+
+def generate(path):
+    with open(path) as f:
+        vector = json.load(f)
+
+    for case in vector['cases']:
+        code = copy.deepcopy(vector['code'])
+        interpreter = Interpreter(code, vector['salt'], case['inputs'])
+        case['outputs'] = interpreter.get_params()
+    vector['source'] = 'planout ' + REFERENCE_VERSION
+
+    with open(path, 'w') as f:
+        json.dump(vector, f, indent=2, sort_keys=True, ensure_ascii=False)
+        f.write('\n')
+
+
+if __name__ == '__main__':
+    version = pkg_resources.get_distribution('planout').version
+    if version != REFERENCE_VERSION:
+        sys.exit('planout %s is installed, the vectors are generated with planout %s'
+                 % (version, REFERENCE_VERSION))
+    for path in sys.argv[1:]:
+        generate(path)
@@ -0,0 +1,180 @@
+package planout
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/biased-unit/planout-golang/compiler"
+)
+
+// TraceNode records the evaluation of an operator, or of an array, when an Interpreter
+// runs with Tracing enabled. Children are the operators evaluated to compute Result,
+// so branches that were not taken, such as those of a cond, do not appear. A return has
+// the in-experiment flag it set as Result, and so do the operators it returned from.
+type TraceNode struct {
+	Op string `json:"op"`
+	// Operands are the arguments of the operator, with the value they evaluated to.
+	// Arguments that were never evaluated are left out.
+	Operands map[string]interface{} `json:"operands,omitempty"`
+	Result   interface{}            `json:"result"`
+	// HashInputs are the strings hashed by random operators, such as "salt.param.userid"
+	HashInputs []string `json:"hash_inputs,omitempty"`
+	// Override is set on get and set operators of a variable that has an override
+	Override bool   `json:"override,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Location is the part of the script the operator was compiled from, when the Interpreter has a SourceMap
+	Location *compiler.Location `json:"location,omitempty"`
+	Children []*TraceNode       `json:"children,omitempty"`
+	code     interface{}
+}
+
+// Trace returns the evaluation tree of the last run, or nil if Tracing was not enabled
+func (interpreter *Interpreter) Trace() *TraceNode {
+	return interpreter.trace
+}
+
+func (interpreter *Interpreter) startTrace(opstr string, code interface{}) {
+	if !interpreter.Tracing {
+		return
+	}
+	node := &TraceNode{Op: opstr, code: code}
+	if js, ok := code.(map[string]interface{}); ok {
+		node.Location = interpreter.location(js)
+	}
+	if n := len(interpreter.traceStack); n > 0 {
+		parent := interpreter.traceStack[n-1]
+		parent.Children = append(parent.Children, node)
+	} else {
+		interpreter.trace = node
+	}
+	interpreter.traceStack = append(interpreter.traceStack, node)
+}
+
+func (interpreter *Interpreter) endTrace(result interface{}) {
+	if !interpreter.Tracing {
+		return
+	}
+	n := len(interpreter.traceStack)
+	node := interpreter.traceStack[n-1]
+	interpreter.traceStack = interpreter.traceStack[:n-1]
+	node.Result = result
+
+	js, ok := node.code.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for key, arg := range js {
+		if key == "op" {
+			continue
+		}
+		if id, isCode := codeID(arg); isCode {
+			for _, child := range node.Children {
+				if childID, _ := codeID(child.code); childID == id {
+					node.setOperand(key, child.Result)
+				}
+			}
+		} else {
+			node.setOperand(key, arg)
+		}
+	}
+}
+
+// failTrace records the error that stopped the run on the operator that raised it
+func (interpreter *Interpreter) failTrace(err error) {
+	if n := len(interpreter.traceStack); n > 0 {
+		interpreter.traceStack[n-1].Error = err.Error()
+	}
+	interpreter.unwindTrace(nil)
+}
+
+// unwindTrace finishes the operators that were still being evaluated when the run
+// stopped, innermost first, so that they record their operands and the given result
+func (interpreter *Interpreter) unwindTrace(result interface{}) {
+	for len(interpreter.traceStack) > 0 {
+		interpreter.endTrace(result)
+	}
+}
+
+// traceHash records a string hashed by the operator being evaluated
+func (interpreter *Interpreter) traceHash(in string) {
+	if n := len(interpreter.traceStack); interpreter.Tracing && n > 0 {
+		node := interpreter.traceStack[n-1]
+		node.HashInputs = append(node.HashInputs, in)
+	}
+}
+
+// traceOverride flags the operator being evaluated as reading or setting an overridden variable
+func (interpreter *Interpreter) traceOverride(name string) {
+	if n := len(interpreter.traceStack); interpreter.Tracing && n > 0 && interpreter.hasOverrides(name) {
+		interpreter.traceStack[n-1].Override = true
+	}
+}
+
+func (node *TraceNode) setOperand(key string, value interface{}) {
+	if node.Operands == nil {
+		node.Operands = map[string]interface{}{}
+	}
+	node.Operands[key] = value
+}
+
+// codeID identifies an operator or array in the code, to match arguments with the
+// trace nodes of their evaluation. Other values are literals.
+func codeID(code interface{}) (uintptr, bool) {
+	if arr, ok := code.([]interface{}); ok && len(arr) == 1 {
+		// evaluate unwraps an array holding a single operator
+		if _, isOp := isOperator(arr[0]); isOp {
+			return codeID(arr[0])
+		}
+	}
+	switch code.(type) {
+	case map[string]interface{}:
+		if _, isOp := isOperator(code); !isOp {
+			return 0, false
+		}
+	case []interface{}:
+	default:
+		return 0, false
+	}
+	return reflect.ValueOf(code).Pointer(), true
+}
+
+// String prints the tree with one operator per line, indented by depth
+func (node *TraceNode) String() string {
+	var b strings.Builder
+	node.write(&b, 0)
+	return b.String()
+}
+
+func (node *TraceNode) write(b *strings.Builder, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	keys := make([]string, 0, len(node.Operands))
+	for k := range node.Operands {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	operands := make([]string, len(keys))
+	for i, k := range keys {
+		operands[i] = fmt.Sprintf("%s=%v", k, node.Operands[k])
+	}
+
+	fmt.Fprintf(b, "%s%s(%s) => %v", indent, node.Op, strings.Join(operands, ", "), node.Result)
+	if node.Location != nil {
+		fmt.Fprintf(b, " [at %v]", node.Location)
+	}
+	if node.Override {
+		b.WriteString(" [override]")
+	}
+	if node.Error != "" {
+		fmt.Fprintf(b, " [error: %s]", node.Error)
+	}
+	b.WriteString("\n")
+	for _, in := range node.HashInputs {
+		fmt.Fprintf(b, "%s  hash %q\n", indent, in)
+	}
+	for _, child := range node.Children {
+		child.write(b, depth+1)
+	}
+}
@@ -0,0 +1,144 @@
+package planout
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func findTraceNodes(node *TraceNode, op string) []*TraceNode {
+	var found []*TraceNode
+	if node.Op == op {
+		found = append(found, node)
+	}
+	for _, child := range node.Children {
+		found = append(found, findTraceNodes(child, op)...)
+	}
+	return found
+}
+
+func TestTrace(t *testing.T) {
+	code, err := Compile(`
+		if (country == "us") {
+			x = uniformChoice(choices=["a", "b"], unit=userid);
+		} else {
+			x = "c";
+		}
+		y = x;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expt := &Interpreter{
+		Salt:      "foo",
+		Inputs:    map[string]interface{}{"country": "us", "userid": "test-id"},
+		Outputs:   map[string]interface{}{},
+		Overrides: map[string]interface{}{"y": "z"},
+		Code:      code,
+		Tracing:   true,
+	}
+	if _, ok := expt.Run(); !ok {
+		t.Fatalf("Unexpected error %v\n", expt.Err())
+	}
+
+	root := expt.Trace()
+	if root == nil || root.Op != "seq" {
+		t.Fatalf("Expected a trace rooted at seq. Actual %v\n", root)
+	}
+
+	choices := findTraceNodes(root, "uniformChoice")
+	if len(choices) != 1 {
+		t.Fatalf("Expected one uniformChoice in the trace. Actual %v\n", root)
+	}
+	choice := choices[0]
+	if !reflect.DeepEqual(choice.HashInputs, []string{"foo.x.test-id"}) {
+		t.Errorf("uniformChoice. Expected hash input foo.x.test-id. Actual %v\n", choice.HashInputs)
+	}
+	if choice.Result != expt.Outputs["x"] || choice.Operands["unit"] != "test-id" ||
+		!reflect.DeepEqual(choice.Operands["choices"], []interface{}{"a", "b"}) {
+		t.Errorf("uniformChoice. Unexpected operands %v or result %v\n", choice.Operands, choice.Result)
+	}
+
+	// Only the branch taken is evaluated
+	for _, set := range findTraceNodes(root, "set") {
+		if set.Operands["value"] == "c" {
+			t.Errorf("Expected the else branch not to be traced. Actual %v\n", set)
+		}
+		if set.Operands["var"] == "y" && !set.Override {
+			t.Errorf("Expected the set of 'y' to be flagged as overridden\n")
+		}
+	}
+
+	data, err := json.Marshal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded TraceNode
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Op != "seq" {
+		t.Errorf("Expected the trace to round trip through JSON. Actual %s (%v)\n", data, err)
+	}
+	if text := root.String(); !strings.Contains(text, `hash "foo.x.test-id"`) || !strings.Contains(text, "[override]") {
+		t.Errorf("Expected the printed trace to show hashes and overrides. Actual\n%v", text)
+	}
+
+	// The operator that failed records the error
+	expt.Code, _ = Compile(`a = 1; b = a / 0;`)
+	if _, ok := expt.Run(); ok {
+		t.Fatalf("Expected division by zero to fail\n")
+	}
+	div := findTraceNodes(expt.Trace(), "/")
+	if len(div) != 1 || div[0].Error != expt.Err().Error() {
+		t.Errorf("Expected the error on the division. Actual\n%v", expt.Trace())
+	}
+
+	expt.Tracing = false
+	expt.Run()
+	if expt.Trace() != nil {
+		t.Errorf("Expected no trace without Tracing\n")
+	}
+}
+
+func TestTraceReturn(t *testing.T) {
+	code, err := Compile(`
+		if (country == "us") {
+			return false;
+		}
+		x = 1;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expt := &Interpreter{
+		Salt:      "foo",
+		Inputs:    map[string]interface{}{"country": "us"},
+		Outputs:   map[string]interface{}{},
+		Overrides: map[string]interface{}{},
+		Code:      code,
+		Tracing:   true,
+	}
+	expt.Run()
+	if expt.Err() != nil {
+		t.Fatalf("Unexpected error %v\n", expt.Err())
+	}
+
+	// The return records the value it returned and the in-experiment flag it set
+	returns := findTraceNodes(expt.Trace(), "return")
+	if len(returns) != 1 || returns[0].Operands["value"] != false || returns[0].Result != false {
+		t.Fatalf("Expected a return of false in the trace. Actual\n%v", expt.Trace())
+	}
+
+	// The operators enclosing it are finished with the flag, and show the branch that fired
+	conds := findTraceNodes(expt.Trace(), "cond")
+	if len(conds) != 1 || conds[0].Result != false || len(findTraceNodes(conds[0], "return")) != 1 {
+		t.Errorf("Expected the cond to be finished by the return. Actual\n%v", expt.Trace())
+	}
+	if root := expt.Trace(); root.Op != "seq" || root.Result != false || len(root.Operands) == 0 {
+		t.Errorf("Expected the seq to be finished by the return. Actual\n%v", root)
+	}
+	if len(findTraceNodes(expt.Trace(), "set")) != 0 {
+		t.Errorf("Expected no statement after the return to be traced. Actual\n%v", expt.Trace())
+	}
+}
@@ -18,6 +18,7 @@ package planout
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"math"
 	"math/rand"
@@ -44,22 +45,174 @@ func getOrElse(m map[string]interface{}, key string, def interface{}) interface{
 }
 
 func compare(lhs, rhs interface{}) int {
+	ret, err := tryCompare(lhs, rhs)
+	if err != nil {
+		panicEvaluation("Compare", err)
+	}
+	return ret
+}
+
+// tryCompare orders two strings or two numbers, and returns an error wrapping
+// ErrIncomparable for any other combination of types.
+func tryCompare(lhs, rhs interface{}) (int, error) {
 	l_str, l_ok := lhs.(string)
 	r_str, r_ok := rhs.(string)
 	if l_ok && r_ok {
-		return cmpString(l_str, r_str)
+		return cmpString(l_str, r_str), nil
 	}
 
 	l_num, l_ok := toNumber(lhs)
 	r_num, r_ok := toNumber(rhs)
 	if l_ok && r_ok {
-		return cmpFloat(l_num, r_num)
+		return cmpFloat(l_num, r_num), nil
 	}
 
-	panic(fmt.Sprintf("Compare: Unsupported type. LHS %v, RHS %v\n", lhs, rhs))
+	return 0, fmt.Errorf("%w: %v (%T) and %v (%T)", ErrIncomparable, lhs, lhs, rhs, rhs)
+}
+
+// compareOrdered compares lhs and rhs for the ordering operators. Null is neither
+// less than nor greater than any value, so ok is false when either side is null.
+func compareOrdered(lhs, rhs interface{}, opstr string) (ret int, ok bool) {
+	if isNull(lhs) || isNull(rhs) {
+		return 0, false
+	}
+
+	ret, err := tryCompare(lhs, rhs)
+	if err != nil {
+		panicEvaluation(opstr, err)
+	}
+	return ret, true
+}
+
+// isEqual reports whether lhs and rhs are deeply equal. Strings, numbers and bools
+// are equal under compare; arrays, maps and structs are equal when all their elements
+// or exported fields are equal; null is only equal to null. Pointers are followed.
+func isEqual(lhs, rhs interface{}) bool {
+	if isNull(lhs) || isNull(rhs) {
+		return isNull(lhs) && isNull(rhs)
+	}
+
+	if ret, err := tryCompare(lhs, rhs); err == nil {
+		return ret == 0
+	}
+
+	l := reflect.ValueOf(lhs)
+	for l.Kind() == reflect.Ptr || l.Kind() == reflect.Interface {
+		l = l.Elem()
+	}
+	r := reflect.ValueOf(rhs)
+	for r.Kind() == reflect.Ptr || r.Kind() == reflect.Interface {
+		r = r.Elem()
+	}
+
+	switch {
+	case isList(l) && isList(r):
+		if l.Len() != r.Len() {
+			return false
+		}
+		for i := 0; i < l.Len(); i++ {
+			if !isEqual(unwrapValue(l.Index(i)), unwrapValue(r.Index(i))) {
+				return false
+			}
+		}
+		return true
+
+	case l.Kind() == reflect.Map && r.Kind() == reflect.Map:
+		if l.Len() != r.Len() {
+			return false
+		}
+		for _, key := range l.MapKeys() {
+			rkey, ok := convertKey(key, r.Type().Key())
+			if !ok {
+				return false
+			}
+			value := r.MapIndex(rkey)
+			if !value.IsValid() || !isEqual(unwrapValue(l.MapIndex(key)), unwrapValue(value)) {
+				return false
+			}
+		}
+		return true
+
+	case l.Kind() == reflect.Struct && r.Kind() == reflect.Struct:
+		if l.Type() != r.Type() {
+			return false
+		}
+		for i := 0; i < l.NumField(); i++ {
+			// Only use exported fields
+			if l.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			if !isEqual(unwrapValue(l.Field(i)), unwrapValue(r.Field(i))) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// convertKey converts a map key to the key type of another map. Only numbers convert to numbers and strings
+// to strings, and only when the conversion keeps the value: the int key 97 is not the string key "a",
+// and the float key 1.5 is not the int key 1.
+func convertKey(key reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	if key.Kind() == reflect.Interface {
+		key = key.Elem()
+	}
+	if !key.IsValid() || !key.Type().ConvertibleTo(t) {
+		return reflect.Value{}, false
+	}
+	if key.Type() == t || t.Kind() == reflect.Interface {
+		return key.Convert(t), true
+	}
+	if key.Kind() != t.Kind() && !(isNumberKind(key.Kind()) && isNumberKind(t.Kind())) {
+		return reflect.Value{}, false
+	}
+	converted := key.Convert(t)
+	if converted.Convert(key.Type()).Interface() != key.Interface() {
+		return reflect.Value{}, false
+	}
+	return converted, true
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Float64
+}
+
+func isList(value reflect.Value) bool {
+	return value.Kind() == reflect.Slice || value.Kind() == reflect.Array
+}
+
+// toList converts any slice or array, such as an []int input, into an []interface{}
+func toList(value interface{}) ([]interface{}, bool) {
+	if list, ok := value.([]interface{}); ok {
+		return list, true
+	}
+	v := reflect.ValueOf(value)
+	if !isList(v) {
+		return nil, false
+	}
+	list := make([]interface{}, v.Len())
+	for i := range list {
+		list[i] = v.Index(i).Interface()
+	}
+	return list, true
+}
+
+// isNull reports whether value is nil or a nil pointer, such as an unset struct field
+func isNull(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	return (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil()
 }
 
 func isTrue(value interface{}) bool {
+	if isNull(value) {
+		return false
+	}
+
 	switch value.(type) {
 	case bool:
 		return value.(bool)
@@ -100,6 +253,12 @@ func cmpString(lhs, rhs string) int {
 }
 
 func add(x, y interface{}) interface{} {
+	x_int, x_ok := toInteger(x)
+	y_int, y_ok := toInteger(y)
+	if x_ok && y_ok {
+		return x_int + y_int
+	}
+
 	x_num, x_ok := toNumber(x)
 	y_num, y_ok := toNumber(y)
 	if x_ok && y_ok {
@@ -127,6 +286,12 @@ func addSlice(x []interface{}) interface{} {
 
 func multiply(x, y interface{}) interface{} {
 
+	x_int, x_ok := toInteger(x)
+	y_int, y_ok := toInteger(y)
+	if x_ok && y_ok {
+		return x_int * y_int
+	}
+
 	x_num, x_ok := toNumber(x)
 	y_num, y_ok := toNumber(y)
 	if x_ok && y_ok {
@@ -170,15 +335,27 @@ func generateUnitStr(units interface{}) string {
 	return ""
 }
 
-func getCummulativeWeights(weights []interface{}) (float64, []float64) {
+// getCummulativeWeights returns the running totals of the weights and their sum.
+// Weights may be any numbers, but must not be negative and must not all be zero.
+func getCummulativeWeights(weights []interface{}) (float64, []float64, error) {
 	nweights := len(weights)
 	cweights := make([]float64, nweights)
 	sum := 0.0
 	for i := range weights {
-		sum = sum + weights[i].(float64)
+		weight, ok := toNumber(weights[i])
+		if !ok {
+			return 0, nil, fmt.Errorf("%w: weight %v (%T) is not a number", ErrUnsupportedType, weights[i], weights[i])
+		}
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return 0, nil, fmt.Errorf("%w: weight %v must be a non-negative finite number", ErrInvalidArgument, weights[i])
+		}
+		sum = sum + weight
 		cweights[i] = sum
 	}
-	return sum, cweights
+	if sum <= 0 {
+		return 0, nil, fmt.Errorf("%w: weights must not all be zero", ErrInvalidArgument)
+	}
+	return sum, cweights, nil
 }
 
 func generateString() string {
@@ -196,6 +373,11 @@ func toString(unit interface{}) (string, bool) {
 		return unit_str, true
 	}
 
+	unit_int, ok := toInteger(unit)
+	if ok {
+		return strconv.FormatInt(unit_int, 10), true
+	}
+
 	unit_num, ok := toNumber(unit)
 	if ok {
 		ret_str := strconv.FormatFloat(unit_num, 'f', -1, 64)
@@ -228,6 +410,12 @@ func toNumber(value interface{}) (float64, bool) {
 	case uint, uint8, uint16, uint32, uint64:
 		i := reflect.ValueOf(value)
 		return float64(i.Uint()), true
+	case json.Number:
+		x, err := value.Float64()
+		if err == nil {
+			return x, true
+		}
+		return 0.0, false
 	case bool:
 		if value {
 			return 1, true
@@ -238,6 +426,53 @@ func toNumber(value interface{}) (float64, bool) {
 	return 0.0, false
 }
 
+// toInteger returns the value as an int64 when it holds an integer. Floats
+// are never integers, even when they have no fractional part, so that integer
+// and float arithmetic stay distinct as they do in the reference PlanOut.
+func toInteger(value interface{}) (int64, bool) {
+	switch value := value.(type) {
+	case int, int8, int16, int32, int64:
+		i := reflect.ValueOf(value)
+		return i.Int(), true
+	case uint, uint8, uint16, uint32, uint64:
+		i := reflect.ValueOf(value).Uint()
+		if i > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(i), true
+	case json.Number:
+		i, err := value.Int64()
+		if err == nil {
+			return i, true
+		}
+		return 0, false
+	case bool:
+		if value {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// asInteger is like toInteger, but also accepts floats that have no fractional
+// part, such as integers decoded with json.Unmarshal. It is meant for operator
+// arguments that must be integers, like counts and ranges.
+func asInteger(value interface{}) (int64, bool) {
+	if i, ok := toInteger(value); ok {
+		return i, true
+	}
+
+	switch value.(type) {
+	case float32, float64:
+		x, _ := toNumber(value)
+		if x == math.Trunc(x) && math.Abs(x) < (1<<63) {
+			return int64(x), true
+		}
+	}
+	return 0, false
+}
+
 func roundNumber(value interface{}) interface{} {
 
 	value_num, ok := toNumber(value)
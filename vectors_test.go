@@ -0,0 +1,114 @@
+package planout
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// referenceVector is a script with the inputs and outputs the reference (Python)
+// PlanOut implementation produced for it. See test/vectors/generate.py.
+type referenceVector struct {
+	Script string
+	Salt   string
+	Source string // implementation the outputs come from, set by generate.py
+	Code   json.RawMessage
+	Cases  []struct {
+		Inputs  json.RawMessage
+		Outputs json.RawMessage
+	}
+}
+
+// referenceSource is the source of the vectors generated with the pinned reference implementation
+const referenceSource = "planout 0.6.0"
+
+func TestReferenceVectors(t *testing.T) {
+	files, err := filepath.Glob("test/vectors/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("No vectors found in test/vectors")
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var vector referenceVector
+			if err := json.Unmarshal(data, &vector); err != nil {
+				t.Fatal(err)
+			}
+			if vector.Source != referenceSource {
+				t.Errorf("%s comes from %q, not %s: regenerate it with test/vectors/generate.py\n", file, vector.Source, referenceSource)
+			}
+
+			for i, tc := range vector.Cases {
+				code, err := Decode(vector.Code)
+				if err != nil {
+					t.Fatal(err)
+				}
+				inputs, err := Decode(tc.Inputs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				expected, err := Decode(tc.Outputs)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				expt := &Interpreter{
+					Salt:      vector.Salt,
+					Inputs:    inputs,
+					Outputs:   map[string]interface{}{},
+					Overrides: map[string]interface{}{},
+					Code:      code,
+				}
+				outputs, ok := expt.Run()
+				if !ok {
+					t.Fatalf("Case %d: error running %s: %v\n", i, file, expt.Err())
+				}
+
+				for name, value := range expected {
+					if !sameValue(value, outputs[name]) {
+						t.Errorf("Case %d, inputs %s: variable '%s'. Expected %v. Actual %v\n", i, tc.Inputs, name, value, outputs[name])
+					}
+				}
+			}
+		})
+	}
+}
+
+// sameValue compares a decoded reference output with an interpreter output.
+// Integers must be integers and floats must be floats with exactly the same value.
+func sameValue(expected, actual interface{}) bool {
+	switch expected := expected.(type) {
+	case int64:
+		i, ok := toInteger(actual)
+		_, isBool := actual.(bool)
+		return ok && !isBool && i == expected
+	case float64:
+		switch actual.(type) {
+		case float32, float64:
+			f, _ := toNumber(actual)
+			return f == expected
+		}
+		return false
+	case []interface{}:
+		a := reflect.ValueOf(actual)
+		if a.Kind() != reflect.Slice || a.Len() != len(expected) {
+			return false
+		}
+		for i := range expected {
+			if !sameValue(expected[i], a.Index(i).Interface()) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(expected, actual)
+}